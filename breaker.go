@@ -0,0 +1,182 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState — состояние автоматического выключателя
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // запросы проходят
+	BreakerOpen                         // запросы отклоняются без обращения к БД
+	BreakerHalfOpen                     // пропускается ограниченное число пробных запросов
+)
+
+// String возвращает название состояния
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig задаёт параметры автоматического выключателя
+type BreakerConfig struct {
+	FailureThreshold int           // сколько ошибок соединения подряд размыкают выключатель
+	OpenTimeout      time.Duration // через сколько разомкнутый выключатель пропускает пробные запросы
+	HalfOpenMaxCalls int           // сколько пробных запросов выполняется одновременно
+}
+
+// DefaultBreakerConfig возвращает параметры выключателя по умолчанию
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      10 * time.Second,
+		HalfOpenMaxCalls: 1,
+	}
+}
+
+// WithCircuitBreaker включает автоматический выключатель перед запросами
+// репозиториев и транзакциями экземпляра
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(o *options) { o.breaker = &cfg }
+}
+
+// circuitBreaker отклоняет обращения к БД, пока она недоступна. Учитываются
+// только ошибки класса ClassConnection: ошибки данных не говорят о
+// недоступности базы.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+	gen      uint64 // увеличивается при каждой смене состояния
+}
+
+// breakerTicket — допуск, выданный allow. По нему done отличает пробы
+// текущего полуоткрытого состояния от обращений, допущенных раньше.
+type breakerTicket struct {
+	gen   uint64
+	probe bool
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.HalfOpenMaxCalls <= 0 {
+		cfg.HalfOpenMaxCalls = 1
+	}
+	return &circuitBreaker{cfg: cfg}
+}
+
+// allow разрешает или отклоняет обращение к БД. Разрешённое обращение
+// должно завершиться вызовом done с полученным допуском.
+func (b *circuitBreaker) allow() (breakerTicket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+		b.halfOpen()
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		return breakerTicket{}, fmt.Errorf("%w: %w", ErrDBConnectionLost, ErrCircuitOpen)
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenMaxCalls {
+			return breakerTicket{}, fmt.Errorf("%w: %w", ErrDBConnectionLost, ErrCircuitOpen)
+		}
+		b.probes++
+		return breakerTicket{gen: b.gen, probe: true}, nil
+	}
+	return breakerTicket{gen: b.gen}, nil
+}
+
+// done учитывает результат разрешённого обращения. Обращения, допущенные до
+// последней смены состояния, не учитываются: медленный запрос, начатый до
+// отказа, не должен замыкать выключатель или занимать чужое место пробы.
+func (b *circuitBreaker) done(t breakerTicket, err error) {
+	connErr := err != nil && ErrorClassOf(err) == ClassConnection
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.gen != b.gen {
+		return
+	}
+
+	if t.probe {
+		b.probes--
+		if connErr {
+			b.open()
+		} else {
+			b.close()
+		}
+		return
+	}
+
+	if !connErr {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.cfg.FailureThreshold {
+		b.open()
+	}
+}
+
+// trip размыкает выключатель по сигналу мониторинга
+func (b *circuitBreaker) trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open()
+}
+
+// probe переводит разомкнутый выключатель в полуоткрытое состояние после
+// восстановления соединения мониторингом
+func (b *circuitBreaker) probe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		b.halfOpen()
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.gen++
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+}
+
+func (b *circuitBreaker) halfOpen() {
+	b.gen++
+	b.state = BreakerHalfOpen
+	b.probes = 0
+}
+
+func (b *circuitBreaker) close() {
+	b.gen++
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probes = 0
+}
+
+// State возвращает текущее состояние выключателя
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerAdmitsQueriesInsideAdmittedTransaction(t *testing.T) {
+	b := newCircuitBreaker(DefaultBreakerConfig())
+	b.trip()
+	b.probe()
+
+	// RunInTransaction занимает единственное место пробы
+	if _, err := b.allow(); err != nil {
+		t.Fatalf("allow для транзакции: %v", err)
+	}
+
+	d := &DB{breaker: b}
+	in := instrumentation{repo: "users", db: d, breaker: b}
+	txCtx := context.WithValue(context.Background(), txContextKey{}, &txState{db: d, tx: &sql.Tx{}})
+	for i := 0; i < 2; i++ {
+		_, q, err := in.start(txCtx, "GetUserByID", "SELECT 1")
+		q.finish(&err)
+		if err != nil {
+			t.Fatalf("запрос %d внутри транзакции отклонён: %v", i+1, err)
+		}
+	}
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Errorf("запросы в транзакции изменили состояние выключателя: %s", got)
+	}
+
+	// Вне транзакции место пробы по-прежнему занято
+	_, q, err := in.start(context.Background(), "GetUserByID", "SELECT 1")
+	q.finish(&err)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("запрос вне транзакции: ошибка %v, ожидалась ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerIgnoresCallsAdmittedBeforeHalfOpen(t *testing.T) {
+	connErr := &DBError{Class: ClassConnection, Err: errors.New("соединение разорвано")}
+
+	tests := []struct {
+		name string
+		err  error // результат медленного обращения, допущенного до отказа
+	}{
+		{"stale success", nil},
+		{"stale connection error", connErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, HalfOpenMaxCalls: 1})
+
+			// Обращение допущено, пока выключатель замкнут
+			stale, err := b.allow()
+			if err != nil {
+				t.Fatalf("allow в замкнутом состоянии: %v", err)
+			}
+
+			b.trip()
+			b.probe()
+			probe, err := b.allow()
+			if err != nil {
+				t.Fatalf("allow пробы: %v", err)
+			}
+
+			// Старое обращение завершается во время пробы
+			b.done(stale, tt.err)
+			if got := b.State(); got != BreakerHalfOpen {
+				t.Fatalf("старое обращение перевело выключатель в %s", got)
+			}
+			if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("вторая проба допущена сверх HalfOpenMaxCalls: %v", err)
+			}
+
+			b.done(probe, nil)
+			if got := b.State(); got != BreakerClosed {
+				t.Fatalf("успешная проба: состояние %s, ожидалось closed", got)
+			}
+		})
+	}
+}
+
+func TestBreakerProbeFailureReopens(t *testing.T) {
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, HalfOpenMaxCalls: 1, OpenTimeout: time.Hour})
+	b.trip()
+	b.probe()
+
+	probe, _ := b.allow()
+	b.done(probe, &DBError{Class: ClassConnection, Err: errors.New("соединение разорвано")})
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("неудачная проба: состояние %s, ожидалось open", got)
+	}
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ConfirmTokenPolicy задаёт срок действия токенов подтверждения email и
+// частоту их перевыпуска
+type ConfirmTokenPolicy struct {
+	TTL            time.Duration // срок действия токена с момента выпуска
+	ResendInterval time.Duration // минимальный интервал между выпусками токена
+}
+
+// DefaultConfirmTokenPolicy используется репозиториями, для которых политика не задана
+var DefaultConfirmTokenPolicy = ConfirmTokenPolicy{TTL: 72 * time.Hour, ResendInterval: time.Minute}
+
+// WithConfirmTokenPolicy задаёт политику токенов подтверждения для
+// репозиториев DB (по умолчанию DefaultConfirmTokenPolicy)
+func WithConfirmTokenPolicy(p ConfirmTokenPolicy) Option {
+	return func(o *options) { o.confirmTokens = &p }
+}
+
+// confirmTokenBytes — длина случайной части токена из NewConfirmToken
+const confirmTokenBytes = 32
+
+// NewConfirmToken возвращает случайный токен подтверждения для
+// CreateUserExtendedContext
+func NewConfirmToken() (string, error) {
+	var b [confirmTokenBytes]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("не удалось сгенерировать токен подтверждения: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+// HashConfirmToken возвращает SHA-256 токена в hex — вид, в котором токен
+// хранится в User.ConfirmToken. Пустой токен означает его отсутствие и
+// остаётся пустым.
+func HashConfirmToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ConfirmTokenMatches сравнивает токен с хранимым хэшем за постоянное время
+func ConfirmTokenMatches(hash, token string) bool {
+	return hash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(HashConfirmToken(token))) == 1
+}
+
+// ConfirmTokenThrottledError — новый токен запрошен раньше, чем истёк
+// ResendInterval с выпуска предыдущего
+type ConfirmTokenThrottledError struct {
+	RetryAfter time.Duration // через сколько можно запросить токен снова
+}
+
+// Error сообщает, когда можно повторить запрос
+func (e *ConfirmTokenThrottledError) Error() string {
+	return fmt.Sprintf("%s: повторите через %s", ErrConfirmTokenThrottled.Error(), e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrConfirmTokenThrottled)
+func (e *ConfirmTokenThrottledError) Unwrap() error {
+	return ErrConfirmTokenThrottled
+}
+
+// isConfirmTokenError проверяет, что ошибка описывает состояние токена, а не сбой
+func isConfirmTokenError(err error) bool {
+	return errors.Is(err, ErrConfirmTokenInvalid) || errors.Is(err, ErrConfirmTokenExpired) ||
+		errors.Is(err, ErrUserAlreadyConfirmed) || errors.Is(err, ErrConfirmTokenThrottled)
+}
+
+// tokenPolicy возвращает политику токенов подтверждения репозитория
+func (r *userRepo) tokenPolicy() ConfirmTokenPolicy {
+	if r.tokens == nil {
+		return DefaultConfirmTokenPolicy
+	}
+	return *r.tokens
+}
+
+// RegenerateConfirmToken выпускает неподтверждённому пользователю новый
+// токен подтверждения и возвращает его; предыдущий токен перестаёт
+// действовать. Если с выпуска предыдущего прошло меньше ResendInterval,
+// возвращается *ConfirmTokenThrottledError, для подтверждённого
+// пользователя — ErrUserAlreadyConfirmed.
+func (r *userRepo) RegenerateConfirmToken(ctx context.Context, email string) (_ string, err error) {
+	token, err := NewConfirmToken()
+	if err != nil {
+		return "", err
+	}
+
+	policy := r.tokenPolicy()
+	email = r.normalizer().Email(email)
+	query := `
+		UPDATE users
+		SET confirm_token = $2, confirm_token_issued_at = NOW(),
+		    confirm_token_expires_at = NOW() + make_interval(secs => $3),
+		    version = version + 1
+		WHERE lower(email) = $1 AND NOT confirmed AND deleted_at IS NULL
+		  AND (confirm_token_issued_at IS NULL OR confirm_token_issued_at <= NOW() - make_interval(secs => $4))
+		RETURNING id`
+	args := []any{email, HashConfirmToken(token), policy.TTL.Seconds(), policy.ResendInterval.Seconds()}
+
+	ctx, q, err := r.ins.start(ctx, "RegenerateConfirmToken", query, args...)
+	defer q.finish(&err)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	err = writerFor(ctx, r.conns).QueryRowContext(ctx, query, args...).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", r.explainRegenerate(ctx, email, policy)
+		}
+		return "", fmt.Errorf("failed to regenerate confirm token: %w", ClassifyError(err))
+	}
+	q.rows = 1
+	return token, nil
+}
+
+// explainRegenerate выясняет, почему RegenerateConfirmToken не выпустил токен
+func (r *userRepo) explainRegenerate(ctx context.Context, email string, policy ConfirmTokenPolicy) error {
+	var (
+		confirmed bool
+		issuedAt  sql.NullTime
+		now       time.Time
+	)
+	err := writerFor(ctx, r.conns).QueryRowContext(ctx, `
+		SELECT confirmed, confirm_token_issued_at, NOW()
+		FROM users
+		WHERE lower(email) = $1 AND deleted_at IS NULL`,
+		email,
+	).Scan(&confirmed, &issuedAt, &now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user by email: %w", ClassifyError(err))
+	}
+
+	if confirmed {
+		return ErrUserAlreadyConfirmed
+	}
+	retryAfter := time.Duration(0)
+	if issuedAt.Valid {
+		retryAfter = issuedAt.Time.Add(policy.ResendInterval).Sub(now)
+	}
+	// Окно могло закончиться между запросами: повторная попытка пройдёт
+	return &ConfirmTokenThrottledError{RetryAfter: max(retryAfter, 0)}
+}
+
+// explainConfirm выясняет, почему ConfirmUserReturning не подтвердил пользователя.
+// Истечение срока сообщается только для верного токена.
+func (r *userRepo) explainConfirm(ctx context.Context, email, token string) error {
+	var (
+		confirmed bool
+		hash      string
+		expired   bool
+	)
+	err := writerFor(ctx, r.conns).QueryRowContext(ctx, `
+		SELECT confirmed, confirm_token, COALESCE(confirm_token_expires_at <= NOW(), TRUE)
+		FROM users
+		WHERE lower(email) = $1 AND deleted_at IS NULL`,
+		email,
+	).Scan(&confirmed, &hash, &expired)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user by email: %w", ClassifyError(err))
+	}
+
+	switch {
+	case confirmed:
+		return ErrUserAlreadyConfirmed
+	case !ConfirmTokenMatches(hash, token):
+		return ErrConfirmTokenInvalid
+	case expired:
+		return ErrConfirmTokenExpired
+	}
+	// Токен перевыпущен или пользователь подтверждён между запросами
+	return ErrConfirmTokenInvalid
+}
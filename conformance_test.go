@@ -0,0 +1,24 @@
+package db_test
+
+import (
+	"testing"
+
+	db "github.com/skrolikov/vira-db"
+	"github.com/skrolikov/vira-db/dbtest"
+)
+
+// Тесты выполняются, только если задан VIRA_DB_TEST_DSN
+
+func TestSQLUsers(t *testing.T) {
+	s := dbtest.NewSchema(t, dbtest.DSN(t))
+	dbtest.RunUserRepositoryTests(t, func(t *testing.T) db.UserRepository {
+		return s.Begin(t).Users
+	})
+}
+
+func TestSQLUserLogins(t *testing.T) {
+	s := dbtest.NewSchema(t, dbtest.DSN(t))
+	dbtest.RunUserLoginRepositoryTests(t, func(t *testing.T) db.UserLoginRepository {
+		return s.Begin(t).UserLogins
+	})
+}
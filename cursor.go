@@ -0,0 +1,107 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Области курсоров: курсор одной выборки не принимается другой
+const (
+	CursorScopeUsersByRole = "users.by_role"
+	CursorScopeUserLogins  = "user_logins.by_user"
+)
+
+const (
+	cursorVersion = 1
+	cursorMACSize = 16
+)
+
+var (
+	cursorKeyMu sync.RWMutex
+	cursorKey   []byte
+)
+
+// SetCursorKey задаёт секрет подписи курсоров пагинации. Его нужно задать до
+// выдачи первого курсора, и у всех экземпляров сервиса он должен быть общим.
+// Без него при первом обращении создаётся случайный ключ, и курсоры перестают
+// приниматься после перезапуска процесса или другими экземплярами.
+func SetCursorKey(key []byte) {
+	cursorKeyMu.Lock()
+	defer cursorKeyMu.Unlock()
+	cursorKey = append([]byte(nil), key...)
+}
+
+// currentCursorKey возвращает ключ курсоров, при первом обращении без
+// SetCursorKey создавая случайный
+func currentCursorKey() []byte {
+	cursorKeyMu.RLock()
+	key := cursorKey
+	cursorKeyMu.RUnlock()
+	if key != nil {
+		return key
+	}
+
+	cursorKeyMu.Lock()
+	defer cursorKeyMu.Unlock()
+	if cursorKey == nil {
+		cursorKey = make([]byte, 32)
+		if _, err := rand.Read(cursorKey); err != nil {
+			panic(fmt.Sprintf("db: не удалось сгенерировать ключ курсоров: %v", err))
+		}
+		if logg != nil {
+			logg.Warn("⚠️ Ключ курсоров пагинации не задан, используется случайный до перезапуска процесса; задайте его через SetCursorKey")
+		}
+	}
+	return cursorKey
+}
+
+// Cursor — позиция keyset-пагинации: ключ сортировки и id последней записи страницы
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// EncodeCursor возвращает непрозрачный подписанный токен курсора для области scope
+func EncodeCursor(scope string, c Cursor) string {
+	payload := make([]byte, 1+8, 1+8+len(c.ID)+cursorMACSize)
+	payload[0] = cursorVersion
+	binary.BigEndian.PutUint64(payload[1:9], uint64(c.Time.UnixMicro()))
+	payload = append(payload, c.ID...)
+	payload = append(payload, cursorMAC(scope, payload)...)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// DecodeCursor проверяет подпись токена и возвращает курсор. Изменённый,
+// подписанный другим ключом или выданный для другой области токен
+// отклоняется с ErrInvalidCursor.
+func DecodeCursor(scope, token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < 1+8+cursorMACSize {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	payload, mac := raw[:len(raw)-cursorMACSize], raw[len(raw)-cursorMACSize:]
+	if !hmac.Equal(mac, cursorMAC(scope, payload)) || payload[0] != cursorVersion {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{
+		Time: time.UnixMicro(int64(binary.BigEndian.Uint64(payload[1:9]))).UTC(),
+		ID:   string(payload[9:]),
+	}, nil
+}
+
+// cursorMAC подписывает область и содержимое курсора
+func cursorMAC(scope string, payload []byte) []byte {
+	h := hmac.New(sha256.New, currentCursorKey())
+	h.Write([]byte(scope))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return h.Sum(nil)[:cursorMACSize]
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	SetCursorKey([]byte("test-key"))
+	t.Cleanup(func() { SetCursorKey(nil) })
+
+	want := Cursor{Time: time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC), ID: "user-1"}
+	valid := EncodeCursor(CursorScopeUsersByRole, want)
+
+	raw, _ := base64.RawURLEncoding.DecodeString(valid)
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-cursorMACSize-1] ^= 1
+
+	// Курсор неизвестной версии с корректной подписью
+	future := append([]byte(nil), raw[:len(raw)-cursorMACSize]...)
+	future[0] = cursorVersion + 1
+	future = append(future, cursorMAC(CursorScopeUsersByRole, future)...)
+
+	tests := []struct {
+		name  string
+		scope string
+		token string
+		key   []byte
+		ok    bool
+	}{
+		{"valid", CursorScopeUsersByRole, valid, nil, true},
+		{"tampered payload", CursorScopeUsersByRole, base64.RawURLEncoding.EncodeToString(tampered), nil, false},
+		{"other scope", CursorScopeUserLogins, valid, nil, false},
+		{"other key", CursorScopeUsersByRole, valid, []byte("other-key"), false},
+		{"unknown version", CursorScopeUsersByRole, base64.RawURLEncoding.EncodeToString(future), nil, false},
+		{"truncated", CursorScopeUsersByRole, valid[:10], nil, false},
+		{"not base64", CursorScopeUsersByRole, "!!!", nil, false},
+		{"empty", CursorScopeUsersByRole, "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.key != nil {
+				SetCursorKey(tt.key)
+				defer SetCursorKey([]byte("test-key"))
+			}
+
+			got, err := DecodeCursor(tt.scope, tt.token)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Fatalf("DecodeCursor = %+v, %v; ожидалась ErrInvalidCursor", got, err)
+				}
+				return
+			}
+			if err != nil || !got.Time.Equal(want.Time) || got.ID != want.ID {
+				t.Fatalf("DecodeCursor = %+v, %v; ожидалось %+v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestCursorKeyRandomFallback(t *testing.T) {
+	SetCursorKey(nil)
+	t.Cleanup(func() { SetCursorKey(nil) })
+
+	token := EncodeCursor(CursorScopeUsersByRole, Cursor{ID: "user-1"})
+	if _, err := DecodeCursor(CursorScopeUsersByRole, token); err != nil {
+		t.Fatalf("курсор со случайным ключом: %v", err)
+	}
+
+	// Явно заданный ключ заменяет случайный
+	SetCursorKey([]byte("explicit"))
+	if _, err := DecodeCursor(CursorScopeUsersByRole, token); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("курсор, подписанный случайным ключом, принят: %v", err)
+	}
+}
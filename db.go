@@ -3,20 +3,21 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	config "github.com/skrolikov/vira-config"
 	logger "github.com/skrolikov/vira-logger"
 )
 
 var (
-	instance *sql.DB
-	once     sync.Once
-	mu       sync.RWMutex
-	logg     *logger.Logger // Кастомный логгер
+	defaultDB *DB
+	mu        sync.RWMutex
+	logg      *logger.Logger // Кастомный логгер
 )
 
 // SetLogger задаёт логгер для пакета db
@@ -34,100 +35,234 @@ type DBStats struct {
 	WaitDuration       time.Duration `json:"wait_duration"`
 	MaxIdleClosed      int64         `json:"max_idle_closed"`
 	MaxLifetimeClosed  int64         `json:"max_lifetime_closed"`
+	CircuitState       string        `json:"circuit_state,omitempty"`
 }
 
-// Init инициализирует соединение с БД (singleton)
-func Init(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
-	var initErr error
+// DB владеет пулом соединений с БД и фоновым мониторингом
+type DB struct {
+	pool *sql.DB // не меняется; соединения открываются через swapConnector
+	cfg  *config.Config
+	log  *logger.Logger
+	opts options
 
-	once.Do(func() {
-		mu.Lock()
-		defer mu.Unlock()
+	mu        sync.RWMutex // защищает connector
+	connector driver.Connector
 
-		conn, err := sql.Open("postgres", cfg.DBUrl)
-		if err != nil {
-			initErr = fmt.Errorf("не удалось открыть соединение с БД: %w", err)
-			if logg != nil {
-				logg.Error("не удалось открыть соединение с БД: %v", err)
-			}
-			return
-		}
+	replicas []*replica
+	rr       atomic.Uint64
 
-		conn.SetMaxOpenConns(cfg.DBMaxOpenConns)
-		conn.SetMaxIdleConns(cfg.DBMaxIdleConns)
-		conn.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
-		conn.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+	inflight  *inflightTracker
+	breaker   *circuitBreaker
+	slowQuery *slowQueryHook
 
-		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
+	historyMu sync.Mutex
+	history   []MonitorResult
 
-		if err = conn.PingContext(pingCtx); err != nil {
-			_ = conn.Close()
-			initErr = fmt.Errorf("не удалось пропинговать БД: %w", err)
-			if logg != nil {
-				logg.Error("не удалось пропинговать БД: %v", err)
-			}
-			return
-		}
+	state  ConnState
+	subsMu sync.Mutex
+	subs   map[int]chan StateEvent
+	nextID int
 
-		instance = conn
+	stopMonitor context.CancelFunc
+	monitorDone chan struct{}
+	closeOnce   sync.Once
+	closeErr    error
+	closed      atomic.Bool
+}
 
-		if logg != nil {
-			logg.Info("✅ Соединение с базой данных установлено успешно")
-		}
+// Option настраивает DB при создании через Open
+type Option func(*options)
+
+type options struct {
+	logger          *logger.Logger
+	monitorInterval time.Duration
+	pingTimeout     time.Duration
+	healthTimeout   time.Duration
+	reconnect       ReconnectPolicy
+	replicaDSNs     []string
+	maxReplicaLag   time.Duration
+	metrics         *Metrics
+	name            string
+	hooks           []QueryHook
+	slowQuery       *SlowQueryConfig
+	healthHistory   int
+	breaker         *BreakerConfig
+	normalizer      *Normalizer
+	confirmTokens   *ConfirmTokenPolicy
+}
 
-		// Запуск мониторинга в отдельной горутине
-		go monitorConnection(ctx, 30*time.Second)
-	})
+// WithLogger задаёт логгер экземпляра (по умолчанию — логгер пакета из SetLogger)
+func WithLogger(l *logger.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
 
-	return instance, initErr
+// WithMonitorInterval задаёт период проверки соединения; 0 отключает мониторинг
+func WithMonitorInterval(d time.Duration) Option {
+	return func(o *options) { o.monitorInterval = d }
 }
 
-// Get возвращает активное соединение с БД
-func Get() (*sql.DB, error) {
-	mu.RLock()
-	defer mu.RUnlock()
+// WithPingTimeout задаёт таймаут начального пинга при открытии соединения
+func WithPingTimeout(d time.Duration) Option {
+	return func(o *options) { o.pingTimeout = d }
+}
 
-	if instance == nil {
-		return nil, ErrDBNotInitialized
-	}
-	return instance, nil
+// WithHealthCheckTimeout задаёт таймаут пинга в HealthCheck
+func WithHealthCheckTimeout(d time.Duration) Option {
+	return func(o *options) { o.healthTimeout = d }
 }
 
-// Close безопасно закрывает соединение с БД
-func Close() error {
-	mu.Lock()
-	defer mu.Unlock()
+// Open открывает новый пул соединений с БД. Мониторинг работает, пока не
+// отменён ctx или не вызван Close.
+func Open(ctx context.Context, cfg *config.Config, opts ...Option) (*DB, error) {
+	o := options{
+		logger:          logg,
+		monitorInterval: 30 * time.Second,
+		pingTimeout:     5 * time.Second,
+		healthTimeout:   3 * time.Second,
+		reconnect:       DefaultReconnectPolicy(),
+		maxReplicaLag:   10 * time.Second,
+		metrics:         DefaultMetrics,
+		healthHistory:   10,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	if instance == nil {
-		return nil
+	d := &DB{cfg: cfg, log: o.logger, opts: o, subs: map[int]chan StateEvent{}, inflight: newInflightTracker()}
+
+	if o.breaker != nil {
+		d.breaker = newCircuitBreaker(*o.breaker)
+	}
+
+	conn, err := d.connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	d.pool = conn
+
+	if err := d.openReplicas(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
 	}
 
-	if err := instance.Close(); err != nil {
-		if logg != nil {
-			logg.Error("не удалось закрыть соединение с БД: %v", err)
+	if o.metrics != nil {
+		if err := o.metrics.register(d, o.name); err != nil {
+			d.closeReplicas()
+			_ = conn.Close()
+			return nil, fmt.Errorf("%w; задайте экземпляру другое имя через WithName", err)
+		}
+	}
+
+	if o.slowQuery != nil {
+		cfg := *o.slowQuery
+		if cfg.Explain == nil {
+			cfg.Explain = d.pool
 		}
-		return fmt.Errorf("не удалось закрыть соединение с БД: %w", err)
+		if cfg.Logger == nil {
+			cfg.Logger = d.log
+		}
+		d.slowQuery = newSlowQueryHook(cfg)
+		d.opts.hooks = append(d.opts.hooks, d.slowQuery)
 	}
 
-	instance = nil
+	if d.log != nil {
+		d.log.Info("✅ Соединение с базой данных установлено успешно")
+	}
 
-	if logg != nil {
-		logg.Info("🔌 Соединение с базой данных закрыто")
+	// Запуск мониторинга в отдельной горутине
+	if o.monitorInterval > 0 {
+		monitorCtx, cancel := context.WithCancel(ctx)
+		d.stopMonitor = cancel
+		d.monitorDone = make(chan struct{})
+		go func() {
+			defer close(d.monitorDone)
+			d.monitorConnection(monitorCtx, o.monitorInterval)
+		}()
 	}
 
-	return nil
+	return d, nil
 }
 
-// Stats возвращает статистику по подключению к БД
-func Stats() (*DBStats, error) {
-	db, err := Get()
+// connect открывает и проверяет пул соединений по конфигурации. Пул
+// открывает соединения через swapConnector, поэтому reconnect может
+// пересоздать подключение, не заменяя сам *sql.DB.
+func (d *DB) connect(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
+	connector, err := pq.NewConnector(cfg.DBUrl)
 	if err != nil {
-		return nil, err
+		if d.log != nil {
+			d.log.Error("не удалось открыть соединение с БД: %v", err)
+		}
+		return nil, fmt.Errorf("не удалось открыть соединение с БД: %w", err)
+	}
+	d.connector = connector
+
+	conn := sql.OpenDB(swapConnector{d: d})
+
+	conn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	conn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	conn.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	pingCtx, cancel := context.WithTimeout(ctx, d.opts.pingTimeout)
+	defer cancel()
+
+	if err = conn.PingContext(pingCtx); err != nil {
+		_ = conn.Close()
+		if d.log != nil {
+			d.log.Error("не удалось пропинговать БД: %v", err)
+		}
+		return nil, fmt.Errorf("не удалось пропинговать БД: %w", err)
 	}
 
-	stats := db.Stats()
-	return &DBStats{
+	return conn, nil
+}
+
+// SQL возвращает пул соединений экземпляра. Пул один на всё время жизни DB:
+// при переподключении заменяется только подключение, через которое он
+// открывает новые соединения, поэтому результат можно сохранять, например, в
+// репозиториях.
+func (d *DB) SQL() *sql.DB {
+	return d.pool
+}
+
+// Close останавливает мониторинг и закрывает пул соединений. Повторные вызовы безопасны.
+func (d *DB) Close() error {
+	d.closeOnce.Do(func() {
+		d.closed.Store(true)
+
+		if d.stopMonitor != nil {
+			d.stopMonitor()
+			<-d.monitorDone
+		}
+
+		d.closeSubscribers()
+		if d.slowQuery != nil {
+			d.slowQuery.close()
+		}
+		d.closeReplicas()
+		if d.opts.metrics != nil {
+			d.opts.metrics.unregister(d)
+		}
+
+		if err := d.SQL().Close(); err != nil {
+			if d.log != nil {
+				d.log.Error("не удалось закрыть соединение с БД: %v", err)
+			}
+			d.closeErr = fmt.Errorf("не удалось закрыть соединение с БД: %w", err)
+			return
+		}
+
+		if d.log != nil {
+			d.log.Info("🔌 Соединение с базой данных закрыто")
+		}
+	})
+	return d.closeErr
+}
+
+// Stats возвращает статистику по подключению к БД
+func (d *DB) Stats() *DBStats {
+	stats := d.SQL().Stats()
+	result := &DBStats{
 		MaxOpenConnections: stats.MaxOpenConnections,
 		OpenConnections:    stats.OpenConnections,
 		InUse:              stats.InUse,
@@ -136,82 +271,128 @@ func Stats() (*DBStats, error) {
 		WaitDuration:       stats.WaitDuration,
 		MaxIdleClosed:      stats.MaxIdleClosed,
 		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
-	}, nil
+	}
+	if d.breaker != nil {
+		result.CircuitState = d.breaker.State().String()
+	}
+	return result
 }
 
 // HealthCheck проверяет состояние подключения
-func HealthCheck(ctx context.Context) error {
-	db, err := Get()
-	if err != nil {
-		return err
-	}
-
-	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+func (d *DB) HealthCheck(ctx context.Context) error {
+	pingCtx, cancel := context.WithTimeout(ctx, d.opts.healthTimeout)
 	defer cancel()
 
-	if err := db.PingContext(pingCtx); err != nil {
+	if err := d.SQL().PingContext(pingCtx); err != nil {
 		return fmt.Errorf("%w: %v", ErrDBConnectionLost, err)
 	}
 	return nil
 }
 
-// monitorConnection периодически проверяет соединение с БД и логгирует ошибки
-func monitorConnection(ctx context.Context, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// Init инициализирует соединение с БД по умолчанию (singleton). Возвращённый
+// пул остаётся действительным после переподключений, пока не вызван Close.
+func Init(ctx context.Context, cfg *config.Config, opts ...Option) (*sql.DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
 
-	for {
-		select {
-		case <-ctx.Done():
-			if logg != nil {
-				logg.Info("🔕 Мониторинг соединения с БД остановлен")
-			}
-			return
-		case <-ticker.C:
-			if err := HealthCheck(ctx); err != nil {
-				if logg != nil {
-					logg.Warn("⚠️ Ошибка проверки здоровья БД: %v", err)
-				}
-				// Здесь можно добавить логику восстановления соединения или алерты
-			} else {
-				if logg != nil {
-					logg.Debug("✔️ Проверка здоровья БД успешна")
-				}
-			}
-		}
+	if defaultDB != nil {
+		return defaultDB.SQL(), nil
+	}
+
+	d, err := Open(ctx, cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defaultDB = d
+	return d.SQL(), nil
+}
+
+// Default возвращает экземпляр DB по умолчанию, созданный через Init
+func Default() (*DB, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if defaultDB == nil {
+		return nil, ErrDBNotInitialized
 	}
+	return defaultDB, nil
 }
 
-// WithTransaction выполняет операции в транзакции
-func WithTransaction(ctx context.Context, fn func(*sql.Tx) error) error {
-	db, err := Get()
+// Get возвращает активное соединение с БД
+func Get() (*sql.DB, error) {
+	d, err := Default()
 	if err != nil {
+		return nil, err
+	}
+	return d.SQL(), nil
+}
+
+// Close безопасно закрывает соединение с БД по умолчанию
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if defaultDB == nil {
+		return nil
+	}
+
+	if err := defaultDB.Close(); err != nil {
 		return err
 	}
 
-	tx, err := db.BeginTx(ctx, nil)
+	defaultDB = nil
+	return nil
+}
+
+// Stats возвращает статистику по подключению к БД по умолчанию
+func Stats() (*DBStats, error) {
+	d, err := Default()
 	if err != nil {
-		return fmt.Errorf("не удалось начать транзакцию: %w", err)
+		return nil, err
 	}
+	return d.Stats(), nil
+}
 
-	defer func() {
-		if p := recover(); p != nil {
-			_ = tx.Rollback()
-			panic(p) // повторно вызываем панику после отката
-		}
-	}()
-
-	if err := fn(tx); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			err = fmt.Errorf("ошибка транзакции: %v, ошибка отката: %w", err, rbErr)
-			return err
-		}
+// HealthCheck проверяет состояние подключения по умолчанию
+func HealthCheck(ctx context.Context) error {
+	d, err := Default()
+	if err != nil {
 		return err
 	}
+	return d.HealthCheck(ctx)
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("не удалось зафиксировать транзакцию: %w", err)
+// WithTransaction выполняет операции в транзакции на соединении по умолчанию.
+// Как и DB.WithTransaction, fn не получает контекста с транзакцией, поэтому
+// вложенные вызовы открывают отдельные транзакции; для вложенности используйте
+// WithTransactionContext или RunInTransaction.
+func WithTransaction(ctx context.Context, fn func(*sql.Tx) error, opts ...TxOption) error {
+	d, err := Default()
+	if err != nil {
+		return err
 	}
+	return d.WithTransaction(ctx, fn, opts...)
+}
 
-	return nil
+// WithTransactionContext выполняет fn в транзакции на соединении по умолчанию,
+// передавая ей контекст с этой транзакцией (см. DB.WithTransactionContext)
+func WithTransactionContext(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error, opts ...TxOption) error {
+	return RunInTransaction(ctx, func(ctx context.Context) error {
+		tx, _ := TxFromContext(ctx)
+		return fn(ctx, tx)
+	}, opts...)
+}
+
+// RunInTransaction выполняет fn в транзакции на соединении по умолчанию,
+// передавая ей контекст с этой транзакцией. Вложенный вызов работает с
+// экземпляром внешней транзакции, даже если Shutdown уже отвязал его от пакета.
+func RunInTransaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	if st, ok := ctx.Value(txContextKey{}).(*txState); ok && st.db != nil {
+		return st.db.RunInTransaction(ctx, fn, opts...)
+	}
+	d, err := Default()
+	if err != nil {
+		return err
+	}
+	return d.RunInTransaction(ctx, fn, opts...)
 }
@@ -0,0 +1,1189 @@
+// Package dbtest содержит вспомогательный код для тестов, работающих с
+// репозиториями пакета db: изолированные схемы PostgreSQL для интеграционных
+// тестов и общий набор проверок соответствия, который прогоняется и на SQL-,
+// и на in-memory реализациях.
+//
+// Пакет предназначен только для тестов и импортирует testing.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// UserRepositoryFactory возвращает пустой репозиторий пользователей для одного подтеста
+type UserRepositoryFactory func(t *testing.T) db.UserRepository
+
+// UserLoginRepositoryFactory возвращает пустой репозиторий истории входов для одного подтеста
+type UserLoginRepositoryFactory func(t *testing.T) db.UserLoginRepository
+
+// RunUserRepositoryTests проверяет, что реализация db.UserRepository ведёт
+// себя как SQL-репозиторий. newRepo вызывается для каждого подтеста и должен
+// возвращать репозиторий без данных:
+//
+//	func TestMemoryUsers(t *testing.T) {
+//		dbtest.RunUserRepositoryTests(t, func(*testing.T) db.UserRepository {
+//			return memdb.NewUserRepository()
+//		})
+//	}
+//
+//	func TestSQLUsers(t *testing.T) {
+//		s := dbtest.NewSchema(t, dbtest.DSN(t))
+//		dbtest.RunUserRepositoryTests(t, func(t *testing.T) db.UserRepository {
+//			return s.Begin(t).Users
+//		})
+//	}
+//
+// Каждый подтест завершается не более чем одной ожидаемой ошибкой запроса,
+// поэтому набор работает и в режиме Schema.Begin.
+func RunUserRepositoryTests(t *testing.T, newRepo UserRepositoryFactory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, repo db.UserRepository)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"NotFound", testUserNotFound},
+		{"DuplicateUsername", testDuplicateUsername},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"Exists", testExists},
+		{"Normalization", testNormalization},
+		{"UpdateUser", testUpdateUser},
+		{"UpdateUserConcurrent", testUpdateUserConcurrent},
+		{"UpdateUserUnversioned", testUpdateUserUnversioned},
+		{"UpdateUserFields", testUpdateUserFields},
+		{"UpdateUserFieldsDuplicate", testUpdateUserFieldsDuplicate},
+		{"UpdateUserDuplicateUsername", testUpdateUserDuplicateUsername},
+		{"UpdateUserDuplicateEmail", testUpdateUserDuplicateEmail},
+		{"DeleteUser", testDeleteUser},
+		{"MutationsNotFound", testMutationsNotFound},
+		{"Returning", testReturning},
+		{"SoftDelete", testSoftDelete},
+		{"RestoreUserConflict", testRestoreUserConflict},
+		{"PurgeDeletedUsers", testPurgeDeletedUsers},
+		{"ConfirmUser", testConfirmUser},
+		{"RegenerateConfirmToken", testRegenerateConfirmToken},
+		{"UpdatePassword", testUpdatePassword},
+		{"GetUsersByRole", testGetUsersByRole},
+		{"SearchUsers", testSearchUsers},
+		{"GetUsersByRolePage", testGetUsersByRolePage},
+		{"InvalidCursor", testInvalidUserCursor},
+		{"CanceledContext", testUserCanceledContext},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, context.Background(), newRepo(t))
+		})
+	}
+}
+
+// RunUserLoginRepositoryTests проверяет, что реализация db.UserLoginRepository
+// ведёт себя как SQL-репозиторий. newRepo вызывается для каждого подтеста и
+// должен возвращать репозиторий без данных.
+func RunUserLoginRepositoryTests(t *testing.T, newRepo UserLoginRepositoryFactory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, repo db.UserLoginRepository)
+	}{
+		{"SaveAndGet", testSaveAndGetLogin},
+		{"UpdateLogoutTime", testUpdateLogoutTime},
+		{"GetLastUserLogins", testGetLastUserLogins},
+		{"GetUserLoginsPage", testGetUserLoginsPage},
+		{"GetFailedLogins", testGetFailedLogins},
+		{"CleanupOldRecords", testCleanupOldRecords},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, context.Background(), newRepo(t))
+		})
+	}
+}
+
+// mustCreate создаёт пользователя с производными от name username и email
+func mustCreate(t *testing.T, ctx context.Context, repo db.UserRepository, name, role string) string {
+	t.Helper()
+
+	id, err := repo.CreateUserExtendedContext(ctx, name, "hash-"+name, name+"@example.com", role, false, "token-"+name)
+	if err != nil {
+		t.Fatalf("CreateUserExtended(%q): %v", name, err)
+	}
+	if id == "" {
+		t.Fatalf("CreateUserExtended(%q) вернул пустой ID", name)
+	}
+	return id
+}
+
+// sameUser сравнивает пользователей, сравнивая время через Equal: драйвер
+// может вернуть одно и то же время в разных часовых поясах
+func sameUser(a, b *db.User) bool {
+	sameNull := func(x, y sql.NullTime) bool { return x.Valid == y.Valid && x.Time.Equal(y.Time) }
+	return a.ID == b.ID && a.Username == b.Username && a.PasswordHash == b.PasswordHash &&
+		a.Email == b.Email && a.Role == b.Role && a.Confirmed == b.Confirmed &&
+		a.ConfirmToken == b.ConfirmToken && a.Version == b.Version &&
+		a.CreatedAt.Equal(b.CreatedAt) && a.UpdatedAt.Equal(b.UpdatedAt) &&
+		sameNull(a.LastLoginAt, b.LastLoginAt) && sameNull(a.PasswordChanged, b.PasswordChanged) &&
+		sameNull(a.DeletedAt, b.DeletedAt) && sameNull(a.ConfirmTokenIssuedAt, b.ConfirmTokenIssuedAt) &&
+		sameNull(a.ConfirmTokenExpiresAt, b.ConfirmTokenExpiresAt)
+}
+
+func mustGet(t *testing.T, ctx context.Context, repo db.UserRepository, id string) *db.User {
+	t.Helper()
+
+	user, err := repo.GetUserByIDContext(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserByID(%q): %v", id, err)
+	}
+	return user
+}
+
+func testCreateAndGet(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	before := time.Now().Add(-time.Second)
+	id := mustCreate(t, ctx, repo, "alice", "admin")
+
+	lookups := map[string]func() (*db.User, error){
+		"GetUserByID":       func() (*db.User, error) { return repo.GetUserByIDContext(ctx, id) },
+		"GetUserByUsername": func() (*db.User, error) { return repo.GetUserByUsernameContext(ctx, "alice") },
+		"GetUserByEmail":    func() (*db.User, error) { return repo.GetUserByEmailContext(ctx, "alice@example.com") },
+	}
+	for name, get := range lookups {
+		user, err := get()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := db.User{
+			ID: id, Username: "alice", PasswordHash: "hash-alice", Email: "alice@example.com",
+			Role: "admin", Confirmed: false, ConfirmToken: db.HashConfirmToken("token-alice"), Version: 1,
+		}
+		got := *user
+		got.CreatedAt, got.UpdatedAt = time.Time{}, time.Time{}
+		got.ConfirmTokenIssuedAt, got.ConfirmTokenExpiresAt = sql.NullTime{}, sql.NullTime{}
+		if got != want {
+			t.Errorf("%s = %+v, ожидалось %+v", name, got, want)
+		}
+		if user.CreatedAt.Before(before) || !user.UpdatedAt.Equal(user.CreatedAt) {
+			t.Errorf("%s: CreatedAt=%v UpdatedAt=%v, ожидалось равное время создания", name, user.CreatedAt, user.UpdatedAt)
+		}
+		issued, expires := user.ConfirmTokenIssuedAt, user.ConfirmTokenExpiresAt
+		if !issued.Valid || !expires.Valid || issued.Time.Before(before) || !expires.Time.After(issued.Time) {
+			t.Errorf("%s: ConfirmTokenIssuedAt=%v ConfirmTokenExpiresAt=%v, ожидался действующий токен", name, issued, expires)
+		}
+	}
+}
+
+func testUserNotFound(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+
+	if _, err := repo.GetUserByIDContext(ctx, "00000000-0000-4000-8000-000000000000"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("GetUserByID: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+	if _, err := repo.GetUserByUsernameContext(ctx, "bob"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("GetUserByUsername: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+	if _, err := repo.GetUserByEmailContext(ctx, "bob@example.com"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("GetUserByEmail: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+}
+
+func testDuplicateUsername(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+
+	_, err := repo.CreateUserExtendedContext(ctx, "alice", "hash", "other@example.com", "user", false, "")
+	if !errors.Is(err, db.ErrDuplicateUsername) || !errors.Is(err, db.ErrUniqueViolation) {
+		t.Fatalf("ошибка %v, ожидалась ErrDuplicateUsername", err)
+	}
+	if db.ErrorClassOf(err) != db.ClassUniqueViolation {
+		t.Errorf("класс ошибки %s, ожидался %s", db.ErrorClassOf(err), db.ClassUniqueViolation)
+	}
+}
+
+func testDuplicateEmail(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+
+	_, err := repo.CreateUserExtendedContext(ctx, "bob", "hash", "alice@example.com", "user", false, "")
+	if !errors.Is(err, db.ErrDuplicateEmail) || !errors.Is(err, db.ErrUniqueViolation) {
+		t.Fatalf("ошибка %v, ожидалась ErrDuplicateEmail", err)
+	}
+	if errors.Is(err, db.ErrDuplicateUsername) {
+		t.Errorf("ошибка %v не должна совпадать с ErrDuplicateUsername", err)
+	}
+}
+
+func testExists(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+
+	checks := []struct {
+		name  string
+		check func() (bool, error)
+		want  bool
+	}{
+		{"ExistsByUsername(alice)", func() (bool, error) { return repo.ExistsByUsernameContext(ctx, "alice") }, true},
+		{"ExistsByUsername(bob)", func() (bool, error) { return repo.ExistsByUsernameContext(ctx, "bob") }, false},
+		{"ExistsByEmail(alice)", func() (bool, error) { return repo.ExistsByEmailContext(ctx, "alice@example.com") }, true},
+		{"ExistsByEmail(bob)", func() (bool, error) { return repo.ExistsByEmailContext(ctx, "bob@example.com") }, false},
+	}
+	for _, c := range checks {
+		got, err := c.check()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s = %v, ожидалось %v", c.name, got, c.want)
+		}
+	}
+}
+
+func testNormalization(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id, err := repo.CreateUserExtendedContext(ctx, "  Alice ", "hash", "Alice@Example.COM\t", "user", false, "token-alice")
+	if err != nil {
+		t.Fatalf("CreateUserExtended: %v", err)
+	}
+	user := mustGet(t, ctx, repo, id)
+	if user.Username != "alice" || user.Email != "alice@example.com" {
+		t.Errorf("сохранены username=%q email=%q, ожидались alice и alice@example.com", user.Username, user.Email)
+	}
+
+	// Полноширинные символы приводятся NFKC к обычным
+	for _, username := range []string{"ALICE", "Alice", "ａｌｉｃｅ"} {
+		if got, err := repo.GetUserByUsernameContext(ctx, username); err != nil || got.ID != id {
+			t.Errorf("GetUserByUsername(%q) = %v, %v", username, got, err)
+		}
+	}
+	if got, err := repo.GetUserByEmailContext(ctx, " ALICE@example.com"); err != nil || got.ID != id {
+		t.Errorf("GetUserByEmail в другом регистре = %v, %v", got, err)
+	}
+	if exists, err := repo.ExistsByEmailContext(ctx, "alice@EXAMPLE.com"); err != nil || !exists {
+		t.Errorf("ExistsByEmail в другом регистре = %v, %v", exists, err)
+	}
+	if result, err := repo.SearchUsers(ctx, db.UserFilter{UsernamePrefix: "AL"}); err != nil || len(result.Users) != 1 {
+		t.Errorf("SearchUsers по префиксу в другом регистре вернул ошибку %v или не ту выборку", err)
+	}
+	if err := repo.ConfirmUserContext(ctx, "ALICE@example.com", "token-alice"); err != nil {
+		t.Errorf("ConfirmUser с email в другом регистре: %v", err)
+	}
+
+	username := "Alice.B"
+	updated, err := repo.UpdateUserFields(ctx, id, db.UserPatch{Username: &username})
+	if err != nil {
+		t.Fatalf("UpdateUserFields: %v", err)
+	}
+	if updated.Username != "alice.b" {
+		t.Errorf("UpdateUserFields сохранил username %q, ожидалось alice.b", updated.Username)
+	}
+
+	if _, err := repo.CreateUserExtendedContext(ctx, "bob", "hash", "ALICE@example.com", "user", false, ""); !errors.Is(err, db.ErrDuplicateEmail) {
+		t.Errorf("email, отличающийся регистром: ошибка %v, ожидалась ErrDuplicateEmail", err)
+	}
+}
+
+func testUpdateUser(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+	user := mustGet(t, ctx, repo, id)
+
+	lastLogin := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	user.Username = "alice2"
+	user.Email = "alice2@example.com"
+	user.Role = "admin"
+	user.Confirmed = true
+	user.LastLoginAt = sql.NullTime{Time: lastLogin, Valid: true}
+	user.PasswordHash = "ignored"
+	user.ConfirmToken = "ignored"
+	if err := repo.UpdateUserContext(ctx, user); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	got := mustGet(t, ctx, repo, id)
+	if got.Version != 2 || user.Version != got.Version {
+		t.Errorf("Version после UpdateUser: в базе %d, у вызывающего %d, ожидалось 2", got.Version, user.Version)
+	}
+	if got.Username != "alice2" || got.Email != "alice2@example.com" || got.Role != "admin" || !got.Confirmed {
+		t.Errorf("после UpdateUser: %+v", got)
+	}
+	if !got.LastLoginAt.Valid || !got.LastLoginAt.Time.Equal(lastLogin) {
+		t.Errorf("LastLoginAt = %v, ожидалось %v", got.LastLoginAt, lastLogin)
+	}
+	// UpdateUser не меняет пароль и токен подтверждения
+	if got.PasswordHash != "hash-alice" || got.ConfirmToken != db.HashConfirmToken("token-alice") {
+		t.Errorf("UpdateUser изменил PasswordHash=%q ConfirmToken=%q", got.PasswordHash, got.ConfirmToken)
+	}
+	if got.UpdatedAt.Before(got.CreatedAt) {
+		t.Errorf("UpdatedAt %v раньше CreatedAt %v", got.UpdatedAt, got.CreatedAt)
+	}
+	if _, err := repo.GetUserByUsernameContext(ctx, "alice"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("старое имя всё ещё находится: %v", err)
+	}
+}
+
+func testUpdateUserConcurrent(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+	first := mustGet(t, ctx, repo, id)
+	second := mustGet(t, ctx, repo, id)
+
+	first.Role = "admin"
+	if err := repo.UpdateUserContext(ctx, first); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	second.Role = "banned"
+	err := repo.UpdateUserContext(ctx, second)
+	if !errors.Is(err, db.ErrConcurrentUpdate) {
+		t.Fatalf("UpdateUser по устаревшей версии: ошибка %v, ожидалась ErrConcurrentUpdate", err)
+	}
+	var conflict *db.ConcurrentUpdateError
+	if !errors.As(err, &conflict) || conflict.Current == nil {
+		t.Fatalf("ошибка %v не содержит актуальную запись", err)
+	}
+	if conflict.Current.Role != "admin" || conflict.Current.Version != first.Version {
+		t.Errorf("актуальная запись %+v, ожидалась роль admin и версия %d", conflict.Current, first.Version)
+	}
+	if got := mustGet(t, ctx, repo, id); got.Role != "admin" {
+		t.Errorf("устаревшее обновление перезаписало роль: %q", got.Role)
+	}
+
+	// Любая запись увеличивает версию
+	if err := repo.UpdatePasswordContext(ctx, id, "new-hash"); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if got := mustGet(t, ctx, repo, id); got.Version != first.Version+1 {
+		t.Errorf("Version после UpdatePassword = %d, ожидалось %d", got.Version, first.Version+1)
+	}
+
+	// Повтор с перечитанной записью проходит
+	retry := mustGet(t, ctx, repo, id)
+	retry.Role = "banned"
+	if err := repo.UpdateUserContext(ctx, retry); err != nil {
+		t.Errorf("UpdateUser с актуальной версией: %v", err)
+	}
+}
+
+func testUpdateUserUnversioned(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+	if err := repo.UpdatePasswordContext(ctx, id, "new-hash"); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+
+	// Запись, собранная вручную без версии, не перезаписывает пользователя
+	user := &db.User{ID: id, Username: "alice", Email: "alice@example.com", Role: "banned"}
+	_, err := repo.UpdateUserReturning(ctx, user)
+	var conflict *db.ConcurrentUpdateError
+	if !errors.As(err, &conflict) || conflict.Current.Version != 2 {
+		t.Fatalf("UpdateUser с Version 0: ошибка %v, ожидалась ConcurrentUpdateError с версией 2", err)
+	}
+	if got := mustGet(t, ctx, repo, id); got.Role != "user" {
+		t.Errorf("UpdateUser с Version 0 перезаписал роль: %q", got.Role)
+	}
+
+	// Явная перезапись без проверки версии
+	user.Role = "admin"
+	updated, err := repo.UpdateUserReturning(db.WithoutVersionCheck(ctx), user)
+	if err != nil {
+		t.Fatalf("UpdateUser с WithoutVersionCheck: %v", err)
+	}
+	if updated.Role != "admin" || updated.Version != 3 {
+		t.Errorf("после UpdateUser с WithoutVersionCheck: роль %q, версия %d; ожидались admin и 3", updated.Role, updated.Version)
+	}
+}
+
+func testUpdateUserFields(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+
+	lastLogin := sql.NullTime{Time: time.Now().Add(-time.Minute).Truncate(time.Microsecond), Valid: true}
+	user, err := repo.UpdateUserFields(ctx, id, db.UserPatch{LastLoginAt: &lastLogin})
+	if err != nil {
+		t.Fatalf("UpdateUserFields(LastLoginAt): %v", err)
+	}
+	if !user.LastLoginAt.Time.Equal(lastLogin.Time) || user.Username != "alice" || user.Role != "user" || user.Version != 2 {
+		t.Errorf("UpdateUserFields(LastLoginAt) = %+v", user)
+	}
+
+	role := "admin"
+	user, err = repo.UpdateUserFields(ctx, id, db.UserPatch{Role: &role, Version: user.Version})
+	if err != nil {
+		t.Fatalf("UpdateUserFields(Role): %v", err)
+	}
+	if user.Role != "admin" || !user.LastLoginAt.Valid || user.Email != "alice@example.com" {
+		t.Errorf("UpdateUserFields(Role) изменил другие поля: %+v", user)
+	}
+	if got := mustGet(t, ctx, repo, id); !sameUser(got, user) {
+		t.Errorf("возвращённая запись %+v не совпадает с сохранённой %+v", user, got)
+	}
+
+	user, err = repo.UpdateUserFields(ctx, id, db.UserPatch{LastLoginAt: &sql.NullTime{}})
+	if err != nil {
+		t.Fatalf("UpdateUserFields(LastLoginAt=NULL): %v", err)
+	}
+	if user.LastLoginAt.Valid {
+		t.Errorf("LastLoginAt не сброшен: %v", user.LastLoginAt)
+	}
+
+	// Пустой патч ничего не записывает
+	same, err := repo.UpdateUserFields(ctx, id, db.UserPatch{})
+	if err != nil || same.Version != user.Version {
+		t.Errorf("пустой патч = %+v, %v; ожидалась версия %d", same, err, user.Version)
+	}
+
+	stale := "banned"
+	_, err = repo.UpdateUserFields(ctx, id, db.UserPatch{Role: &stale, Version: 1})
+	var conflict *db.ConcurrentUpdateError
+	if !errors.As(err, &conflict) || conflict.Current.Version != user.Version {
+		t.Errorf("патч устаревшей версии: ошибка %v, ожидалась ConcurrentUpdateError с версией %d", err, user.Version)
+	}
+
+	if _, err := repo.UpdateUserFields(ctx, "00000000-0000-4000-8000-000000000000", db.UserPatch{Role: &role}); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("патч несуществующего пользователя: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+}
+
+func testUpdateUserFieldsDuplicate(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+	bob := mustCreate(t, ctx, repo, "bob", "user")
+
+	email := "alice@example.com"
+	if _, err := repo.UpdateUserFields(ctx, bob, db.UserPatch{Email: &email}); !errors.Is(err, db.ErrDuplicateEmail) {
+		t.Errorf("патч с занятым email: ошибка %v, ожидалась ErrDuplicateEmail", err)
+	}
+}
+
+func testUpdateUserDuplicateUsername(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+	bob := mustGet(t, ctx, repo, mustCreate(t, ctx, repo, "bob", "user"))
+
+	// Сохранение пользователя без изменений не конфликтует с ним самим
+	if err := repo.UpdateUserContext(ctx, bob); err != nil {
+		t.Fatalf("UpdateUser без изменений: %v", err)
+	}
+
+	bob.Username = "alice"
+	if err := repo.UpdateUserContext(ctx, bob); !errors.Is(err, db.ErrDuplicateUsername) {
+		t.Errorf("UpdateUser с занятым username: ошибка %v, ожидалась ErrDuplicateUsername", err)
+	}
+}
+
+func testUpdateUserDuplicateEmail(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+	bob := mustGet(t, ctx, repo, mustCreate(t, ctx, repo, "bob", "user"))
+
+	bob.Email = "alice@example.com"
+	if err := repo.UpdateUserContext(ctx, bob); !errors.Is(err, db.ErrDuplicateEmail) {
+		t.Errorf("UpdateUser с занятым email: ошибка %v, ожидалась ErrDuplicateEmail", err)
+	}
+}
+
+func testDeleteUser(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+
+	if err := repo.DeleteUserContext(ctx, id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := repo.GetUserByIDContext(ctx, id); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("после DeleteUser: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+	if err := repo.DeleteUserContext(ctx, id); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("повторный DeleteUser: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+	// Освободившиеся username и email можно использовать снова
+	mustCreate(t, ctx, repo, "alice", "user")
+}
+
+func testMutationsNotFound(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	const missing = "00000000-0000-4000-8000-000000000000"
+	mustCreate(t, ctx, repo, "alice", "user")
+
+	mutations := map[string]func() error{
+		"UpdateUser": func() error {
+			return repo.UpdateUserContext(ctx, &db.User{ID: missing, Username: "bob", Email: "bob@example.com", Version: 1})
+		},
+		"DeleteUser":     func() error { return repo.DeleteUserContext(ctx, missing) },
+		"UpdatePassword": func() error { return repo.UpdatePasswordContext(ctx, missing, "new-hash") },
+		"RestoreUser":    func() error { return repo.RestoreUser(ctx, missing) },
+	}
+	for name, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, db.ErrUserNotFound) {
+			t.Errorf("%s несуществующего: ошибка %v, ожидалась ErrUserNotFound", name, err)
+		}
+	}
+}
+
+func testReturning(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	created, err := repo.CreateUserExtendedReturning(ctx, "Alice", "hash-alice", "alice@example.com", "user", false, "token-alice")
+	if err != nil {
+		t.Fatalf("CreateUserExtendedReturning: %v", err)
+	}
+	id := created.ID
+	if id == "" || created.Username != "alice" || created.Version != 1 || created.CreatedAt.IsZero() ||
+		created.ConfirmToken != db.HashConfirmToken("token-alice") || !created.ConfirmTokenExpiresAt.Valid {
+		t.Errorf("CreateUserExtendedReturning = %+v", created)
+	}
+	if got := mustGet(t, ctx, repo, id); !sameUser(got, created) {
+		t.Errorf("CreateUserExtendedReturning = %+v, в базе %+v", created, got)
+	}
+
+	confirmed, err := repo.ConfirmUserReturning(ctx, "alice@example.com", "token-alice")
+	if err != nil {
+		t.Fatalf("ConfirmUserReturning: %v", err)
+	}
+	if confirmed.ID != id || !confirmed.Confirmed || confirmed.ConfirmToken != "" || confirmed.Version != 2 {
+		t.Errorf("ConfirmUserReturning = %+v", confirmed)
+	}
+
+	changed, err := repo.UpdatePasswordReturning(ctx, id, "new-hash")
+	if err != nil {
+		t.Fatalf("UpdatePasswordReturning: %v", err)
+	}
+	if changed.PasswordHash != "new-hash" || !changed.PasswordChanged.Valid || changed.Version != 3 {
+		t.Errorf("UpdatePasswordReturning = %+v", changed)
+	}
+
+	input := *changed
+	input.Role = "admin"
+	updated, err := repo.UpdateUserReturning(ctx, &input)
+	if err != nil {
+		t.Fatalf("UpdateUserReturning: %v", err)
+	}
+	if updated.Role != "admin" || updated.Version != 4 {
+		t.Errorf("UpdateUserReturning = %+v", updated)
+	}
+	if input.Version != 3 {
+		t.Errorf("UpdateUserReturning изменил переданного пользователя: Version=%d", input.Version)
+	}
+	if got := mustGet(t, ctx, repo, id); !sameUser(got, updated) {
+		t.Errorf("UpdateUserReturning = %+v, в базе %+v", updated, got)
+	}
+
+	deleted, err := repo.DeleteUserReturning(ctx, id)
+	if err != nil {
+		t.Fatalf("DeleteUserReturning: %v", err)
+	}
+	if !deleted.DeletedAt.Valid || deleted.Version != 5 {
+		t.Errorf("DeleteUserReturning = %+v", deleted)
+	}
+
+	restored, err := repo.RestoreUserReturning(ctx, id)
+	if err != nil {
+		t.Fatalf("RestoreUserReturning: %v", err)
+	}
+	if restored.DeletedAt.Valid || restored.Version != 6 {
+		t.Errorf("RestoreUserReturning = %+v", restored)
+	}
+	if got := mustGet(t, ctx, repo, id); !sameUser(got, restored) {
+		t.Errorf("RestoreUserReturning = %+v, в базе %+v", restored, got)
+	}
+}
+
+func testSoftDelete(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "member")
+	mustCreate(t, ctx, repo, "bob", "member")
+	if err := repo.DeleteUserContext(ctx, id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	if exists, err := repo.ExistsByUsernameContext(ctx, "alice"); err != nil || exists {
+		t.Errorf("ExistsByUsername удалённого = %v, %v", exists, err)
+	}
+	if users, err := repo.GetUsersByRoleContext(ctx, "member", 10, 0); err != nil || len(users) != 1 {
+		t.Errorf("GetUsersByRole без удалённых = %d записей, %v", len(users), err)
+	}
+	if result, err := repo.SearchUsers(ctx, db.UserFilter{Role: "member"}); err != nil || len(result.Users) != 1 {
+		t.Errorf("SearchUsers без удалённых вернул ошибку %v или лишние записи", err)
+	}
+
+	withDeleted := db.WithDeletedUsers(ctx)
+	user, err := repo.GetUserByIDContext(withDeleted, id)
+	if err != nil {
+		t.Fatalf("GetUserByID с WithDeletedUsers: %v", err)
+	}
+	if !user.DeletedAt.Valid {
+		t.Errorf("DeletedAt удалённого пользователя не заполнен")
+	}
+	if users, err := repo.GetUsersByRoleContext(withDeleted, "member", 10, 0); err != nil || len(users) != 2 {
+		t.Errorf("GetUsersByRole с удалёнными = %d записей, %v", len(users), err)
+	}
+	if page, err := repo.GetUsersByRolePage(withDeleted, "member", 10, ""); err != nil || len(page.Users) != 2 {
+		t.Errorf("GetUsersByRolePage с удалёнными вернул ошибку %v или не все записи", err)
+	}
+
+	// Удалённого пользователя нельзя изменить или подтвердить
+	if err := repo.ConfirmUserContext(ctx, "alice@example.com", "token-alice"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("ConfirmUser удалённого: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+
+	if err := repo.RestoreUser(ctx, id); err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	restored := mustGet(t, ctx, repo, id)
+	if restored.DeletedAt.Valid || restored.Username != "alice" {
+		t.Errorf("после RestoreUser: %+v", restored)
+	}
+	if err := repo.RestoreUser(ctx, id); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("RestoreUser не удалённого: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+}
+
+func testRestoreUserConflict(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+	if err := repo.DeleteUserContext(ctx, id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	mustCreate(t, ctx, repo, "alice", "user")
+
+	if err := repo.RestoreUser(ctx, id); !errors.Is(err, db.ErrDuplicateUsername) {
+		t.Errorf("RestoreUser при занятом username: ошибка %v, ожидалась ErrDuplicateUsername", err)
+	}
+}
+
+func testPurgeDeletedUsers(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	deleted := mustCreate(t, ctx, repo, "alice", "user")
+	kept := mustCreate(t, ctx, repo, "bob", "user")
+	if err := repo.DeleteUserContext(ctx, deleted); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	if n, err := repo.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PurgeDeletedUsers до срока хранения = %d, %v; ожидалось 0", n, err)
+	}
+	if n, err := repo.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("PurgeDeletedUsers = %d, %v; ожидалось 1", n, err)
+	}
+
+	if _, err := repo.GetUserByIDContext(db.WithDeletedUsers(ctx), deleted); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("пользователь после PurgeDeletedUsers: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+	mustGet(t, ctx, repo, kept)
+}
+
+func testConfirmUser(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+
+	if err := repo.ConfirmUserContext(ctx, "alice@example.com", "wrong"); !errors.Is(err, db.ErrConfirmTokenInvalid) {
+		t.Errorf("ConfirmUser с неверным токеном: ошибка %v, ожидалась ErrConfirmTokenInvalid", err)
+	}
+	// Хранится только хэш: он сам не подходит как токен
+	if err := repo.ConfirmUserContext(ctx, "alice@example.com", db.HashConfirmToken("token-alice")); !errors.Is(err, db.ErrConfirmTokenInvalid) {
+		t.Errorf("ConfirmUser с хэшем токена: ошибка %v, ожидалась ErrConfirmTokenInvalid", err)
+	}
+	if err := repo.ConfirmUserContext(ctx, "bob@example.com", "token-alice"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("ConfirmUser с чужим email: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+	if err := repo.ConfirmUserContext(ctx, "alice@example.com", "token-alice"); err != nil {
+		t.Fatalf("ConfirmUser: %v", err)
+	}
+
+	user := mustGet(t, ctx, repo, id)
+	if !user.Confirmed || user.ConfirmToken != "" || user.ConfirmTokenExpiresAt.Valid {
+		t.Errorf("после ConfirmUser Confirmed=%v ConfirmToken=%q ConfirmTokenExpiresAt=%v", user.Confirmed, user.ConfirmToken, user.ConfirmTokenExpiresAt)
+	}
+	if err := repo.ConfirmUserContext(ctx, "alice@example.com", "token-alice"); !errors.Is(err, db.ErrUserAlreadyConfirmed) {
+		t.Errorf("повторный ConfirmUser: ошибка %v, ожидалась ErrUserAlreadyConfirmed", err)
+	}
+}
+
+func testRegenerateConfirmToken(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "user")
+	if _, err := repo.CreateUserExtendedContext(ctx, "bob", "hash-bob", "bob@example.com", "user", false, ""); err != nil {
+		t.Fatalf("CreateUserExtended без токена: %v", err)
+	}
+	if _, err := repo.CreateUserExtendedContext(ctx, "carol", "hash-carol", "carol@example.com", "user", true, ""); err != nil {
+		t.Fatalf("CreateUserExtended подтверждённого: %v", err)
+	}
+
+	// Токен alice только что выпущен, поэтому новый пока не выдаётся
+	_, err := repo.RegenerateConfirmToken(ctx, "alice@example.com")
+	var throttled *db.ConfirmTokenThrottledError
+	if !errors.As(err, &throttled) || !errors.Is(err, db.ErrConfirmTokenThrottled) {
+		t.Errorf("RegenerateConfirmToken сразу после выпуска: ошибка %v, ожидалась ConfirmTokenThrottledError", err)
+	} else if throttled.RetryAfter <= 0 || throttled.RetryAfter > db.DefaultConfirmTokenPolicy.ResendInterval {
+		t.Errorf("RetryAfter = %v, ожидалось в пределах (0, %v]", throttled.RetryAfter, db.DefaultConfirmTokenPolicy.ResendInterval)
+	}
+
+	if _, err := repo.RegenerateConfirmToken(ctx, "carol@example.com"); !errors.Is(err, db.ErrUserAlreadyConfirmed) {
+		t.Errorf("RegenerateConfirmToken подтверждённого: ошибка %v, ожидалась ErrUserAlreadyConfirmed", err)
+	}
+	if _, err := repo.RegenerateConfirmToken(ctx, "dave@example.com"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("RegenerateConfirmToken неизвестного email: ошибка %v, ожидалась ErrUserNotFound", err)
+	}
+
+	// У bob токена не было, так что выпуск не ограничен
+	token, err := repo.RegenerateConfirmToken(ctx, "BOB@example.com")
+	if err != nil {
+		t.Fatalf("RegenerateConfirmToken: %v", err)
+	}
+	if token == "" {
+		t.Fatalf("RegenerateConfirmToken вернул пустой токен")
+	}
+	bob, err := repo.GetUserByEmailContext(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if bob.ConfirmToken != db.HashConfirmToken(token) || !bob.ConfirmTokenExpiresAt.Valid {
+		t.Errorf("после RegenerateConfirmToken ConfirmToken=%q ConfirmTokenExpiresAt=%v", bob.ConfirmToken, bob.ConfirmTokenExpiresAt)
+	}
+	if _, err := repo.RegenerateConfirmToken(ctx, "bob@example.com"); !errors.Is(err, db.ErrConfirmTokenThrottled) {
+		t.Errorf("повторный RegenerateConfirmToken: ошибка %v, ожидалась ErrConfirmTokenThrottled", err)
+	}
+	if err := repo.ConfirmUserContext(ctx, "bob@example.com", token); err != nil {
+		t.Errorf("ConfirmUser с новым токеном: %v", err)
+	}
+}
+
+func testUpdatePassword(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	id := mustCreate(t, ctx, repo, "alice", "user")
+
+	if err := repo.UpdatePasswordContext(ctx, id, "new-hash"); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+
+	user := mustGet(t, ctx, repo, id)
+	if user.PasswordHash != "new-hash" {
+		t.Errorf("PasswordHash = %q, ожидалось new-hash", user.PasswordHash)
+	}
+	if !user.PasswordChanged.Valid || user.PasswordChanged.Time.Before(user.CreatedAt) {
+		t.Errorf("PasswordChanged = %v, ожидалось время не раньше создания", user.PasswordChanged)
+	}
+}
+
+func testGetUsersByRole(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	const total = 5
+	ids := map[string]bool{}
+	for i := range total {
+		ids[mustCreate(t, ctx, repo, fmt.Sprintf("user%d", i), "member")] = true
+		// Разное время создания делает порядок однозначным вне транзакции
+		time.Sleep(2 * time.Millisecond)
+	}
+	mustCreate(t, ctx, repo, "admin", "admin")
+
+	var all []*db.User
+	for offset := 0; ; offset += 2 {
+		page, err := repo.GetUsersByRoleContext(ctx, "member", 2, offset)
+		if err != nil {
+			t.Fatalf("GetUsersByRole(offset=%d): %v", offset, err)
+		}
+		if len(page) > 2 {
+			t.Fatalf("GetUsersByRole(limit=2) вернул %d записей", len(page))
+		}
+		if len(page) == 0 {
+			break
+		}
+		all = append(all, page...)
+	}
+
+	if len(all) != total {
+		t.Fatalf("страницы содержат %d пользователей, ожидалось %d", len(all), total)
+	}
+	for i, user := range all {
+		if !ids[user.ID] {
+			t.Errorf("пользователь %s (%s) отсутствует или повторяется", user.ID, user.Role)
+		}
+		delete(ids, user.ID)
+		if i > 0 && user.CreatedAt.After(all[i-1].CreatedAt) {
+			t.Errorf("порядок нарушен: %v после %v, ожидалось created_at DESC", user.CreatedAt, all[i-1].CreatedAt)
+		}
+	}
+
+	none, err := repo.GetUsersByRoleContext(ctx, "nobody", 10, 0)
+	if err != nil || len(none) != 0 {
+		t.Errorf("GetUsersByRole(nobody) = %d записей, %v", len(none), err)
+	}
+}
+
+func testSearchUsers(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	accounts := []struct {
+		username, email, role string
+		confirmed             bool
+	}{
+		{"alice", "alice@corp.io", "admin", true},
+		{"bob", "bob@Example.com", "user", false},
+		{"bobby", "bobby@corp.io", "user", true},
+		{"carol", "carol@example.com", "user", false},
+	}
+	ids := map[string]string{}
+	for _, a := range accounts {
+		id, err := repo.CreateUserExtendedContext(ctx, a.username, "hash", a.email, a.role, a.confirmed, "")
+		if err != nil {
+			t.Fatalf("CreateUserExtended(%q): %v", a.username, err)
+		}
+		ids[a.username] = id
+	}
+
+	lastLogin := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	carol := mustGet(t, ctx, repo, ids["carol"])
+	carol.LastLoginAt = sql.NullTime{Time: lastLogin, Valid: true}
+	if err := repo.UpdateUserContext(ctx, carol); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	confirmed := true
+	byUsername := []db.UserSort{{Field: db.SortByUsername}}
+	cases := []struct {
+		name      string
+		filter    db.UserFilter
+		want      []string
+		wantTotal int
+	}{
+		{"Role", db.UserFilter{Role: "user", Sort: byUsername, CountTotal: true}, []string{"bob", "bobby", "carol"}, 3},
+		{"Confirmed", db.UserFilter{Confirmed: &confirmed, Sort: byUsername}, []string{"alice", "bobby"}, -1},
+		{"UsernamePrefix", db.UserFilter{UsernamePrefix: "bob", Sort: byUsername}, []string{"bob", "bobby"}, -1},
+		{"UsernamePrefixEscaped", db.UserFilter{UsernamePrefix: "b_b", CountTotal: true}, nil, 0},
+		{"EmailDomain", db.UserFilter{EmailDomain: "EXAMPLE.com", Sort: byUsername}, []string{"bob", "carol"}, -1},
+		{"LastLogin", db.UserFilter{LastLoginFrom: lastLogin, LastLoginTo: lastLogin.Add(time.Minute)}, []string{"carol"}, -1},
+		{"Page", db.UserFilter{Role: "user", Sort: byUsername, Limit: 1, Offset: 1, CountTotal: true}, []string{"bobby"}, 3},
+		{"PageBeyondEnd", db.UserFilter{Role: "user", Limit: 2, Offset: 10, CountTotal: true}, nil, 3},
+		{"SortDesc", db.UserFilter{Sort: []db.UserSort{{Field: db.SortByEmail, Desc: true}}}, []string{"carol", "bobby", "bob", "alice"}, -1},
+		{"SortLastLoginNullsLast", db.UserFilter{Role: "user", Sort: []db.UserSort{{Field: db.SortByLastLogin, Desc: true}, {Field: db.SortByUsername, Desc: true}}}, []string{"carol", "bobby", "bob"}, -1},
+	}
+	for _, c := range cases {
+		result, err := repo.SearchUsers(ctx, c.filter)
+		if err != nil {
+			t.Fatalf("%s: SearchUsers: %v", c.name, err)
+		}
+		var got []string
+		for _, u := range result.Users {
+			got = append(got, u.Username)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.want) || result.Total != c.wantTotal {
+			t.Errorf("%s: SearchUsers = %v (всего %d), ожидалось %v (всего %d)", c.name, got, result.Total, c.want, c.wantTotal)
+		}
+	}
+
+	// Порядок по умолчанию — от новых к старым
+	result, err := repo.SearchUsers(ctx, db.UserFilter{})
+	if err != nil {
+		t.Fatalf("SearchUsers: %v", err)
+	}
+	if len(result.Users) != len(accounts) {
+		t.Fatalf("SearchUsers без фильтра вернул %d пользователей, ожидалось %d", len(result.Users), len(accounts))
+	}
+	for i := 1; i < len(result.Users); i++ {
+		if result.Users[i].CreatedAt.After(result.Users[i-1].CreatedAt) {
+			t.Errorf("порядок нарушен: %v после %v, ожидалось created_at DESC", result.Users[i].CreatedAt, result.Users[i-1].CreatedAt)
+		}
+	}
+}
+
+func testGetUsersByRolePage(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	const total = 5
+	for i := range total {
+		mustCreate(t, ctx, repo, fmt.Sprintf("user%d", i), "member")
+		time.Sleep(2 * time.Millisecond)
+	}
+	mustCreate(t, ctx, repo, "admin", "admin")
+
+	var (
+		all    []*db.User
+		cursor string
+		added  *db.User
+	)
+	for pages := 0; ; pages++ {
+		if pages > total {
+			t.Fatalf("пагинация не завершилась за %d страниц", pages)
+		}
+		page, err := repo.GetUsersByRolePage(ctx, "member", 2, cursor)
+		if err != nil {
+			t.Fatalf("GetUsersByRolePage: %v", err)
+		}
+		all = append(all, page.Users...)
+		if page.NextCursor == "" {
+			break
+		}
+		if len(page.Users) != 2 {
+			t.Fatalf("неполная страница из %d записей с продолжением", len(page.Users))
+		}
+		cursor = page.NextCursor
+
+		// Пользователь, созданный во время обхода, не сдвигает страницы
+		if added == nil {
+			added = mustGet(t, ctx, repo, mustCreate(t, ctx, repo, "late", "member"))
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, u := range all {
+		if seen[u.ID] {
+			t.Errorf("пользователь %s встречается дважды", u.Username)
+		}
+		seen[u.ID] = true
+		if i > 0 {
+			prev := all[i-1]
+			if u.CreatedAt.After(prev.CreatedAt) || u.CreatedAt.Equal(prev.CreatedAt) && u.ID > prev.ID {
+				t.Errorf("порядок нарушен: %s после %s, ожидалось (created_at, id) DESC", u.Username, prev.Username)
+			}
+		}
+	}
+	// Вне транзакции новый пользователь создан позже всех и остаётся до курсора
+	lateIsNewest := added.CreatedAt.After(all[0].CreatedAt)
+	if lateIsNewest && seen[added.ID] {
+		t.Errorf("пользователь, созданный во время обхода, попал в последующие страницы")
+	}
+	if want := total + boolInt(seen[added.ID]); len(all) != want {
+		t.Errorf("обход вернул %d пользователей, ожидалось %d", len(all), want)
+	}
+}
+
+func testInvalidUserCursor(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	mustCreate(t, ctx, repo, "alice", "member")
+	mustCreate(t, ctx, repo, "bob", "member")
+
+	page, err := repo.GetUsersByRolePage(ctx, "member", 1, "")
+	if err != nil {
+		t.Fatalf("GetUsersByRolePage: %v", err)
+	}
+	if page.NextCursor == "" {
+		t.Fatalf("GetUsersByRolePage(limit=1) не вернул курсор при двух пользователях")
+	}
+
+	tampered := []byte(page.NextCursor)
+	if tampered[0] == 'A' {
+		tampered[0] = 'B'
+	} else {
+		tampered[0] = 'A'
+	}
+	foreign := db.EncodeCursor(db.CursorScopeUserLogins, db.Cursor{Time: time.Now(), ID: page.Users[0].ID})
+
+	for name, cursor := range map[string]string{
+		"изменённый":        string(tampered),
+		"не base64":         "not a cursor!",
+		"из другой выборки": foreign,
+	} {
+		if _, err := repo.GetUsersByRolePage(ctx, "member", 1, cursor); !errors.Is(err, db.ErrInvalidCursor) {
+			t.Errorf("%s курсор: ошибка %v, ожидалась ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func testUserCanceledContext(t *testing.T, ctx context.Context, repo db.UserRepository) {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := repo.CreateUserExtendedContext(ctx, "alice", "hash", "alice@example.com", "user", false, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateUserExtended с отменённым контекстом: ошибка %v, ожидалась context.Canceled", err)
+	}
+	if _, err := repo.GetUserByUsernameContext(ctx, "alice"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetUserByUsername с отменённым контекстом: ошибка %v, ожидалась context.Canceled", err)
+	}
+}
+
+func testSaveAndGetLogin(t *testing.T, ctx context.Context, repo db.UserLoginRepository) {
+	loginTime := time.Now().Truncate(time.Microsecond)
+	if err := repo.Save(ctx, "u1", "alice", "10.0.0.1", "curl", "s1", loginTime, true, ""); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := repo.Save(ctx, "u1", "alice", "10.0.0.1", "curl", "s2", loginTime, false, "bad password"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	login, err := repo.GetBySessionID(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetBySessionID: %v", err)
+	}
+	if login.ID == "" || login.UserID != "u1" || login.Username != "alice" || login.IP != "10.0.0.1" ||
+		login.UserAgent != "curl" || !login.Success || login.FailReason.Valid || login.LogoutTime.Valid {
+		t.Errorf("GetBySessionID(s1) = %+v", login)
+	}
+	if !login.LoginTime.Equal(loginTime) {
+		t.Errorf("LoginTime = %v, ожидалось %v", login.LoginTime, loginTime)
+	}
+
+	failed, err := repo.GetBySessionID(ctx, "s2")
+	if err != nil {
+		t.Fatalf("GetBySessionID: %v", err)
+	}
+	if failed.Success || failed.FailReason != (sql.NullString{String: "bad password", Valid: true}) {
+		t.Errorf("GetBySessionID(s2) = %+v", failed)
+	}
+
+	if _, err := repo.GetBySessionID(ctx, "missing"); !errors.Is(err, db.ErrLoginNotFound) {
+		t.Errorf("GetBySessionID(missing): ошибка %v, ожидалась ErrLoginNotFound", err)
+	}
+}
+
+func testUpdateLogoutTime(t *testing.T, ctx context.Context, repo db.UserLoginRepository) {
+	loginTime := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	if err := repo.Save(ctx, "u1", "alice", "", "", "s1", loginTime, true, ""); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	logoutTime := loginTime.Add(30 * time.Minute)
+	if err := repo.UpdateLogoutTime(ctx, "s1", logoutTime); err != nil {
+		t.Fatalf("UpdateLogoutTime: %v", err)
+	}
+	login, err := repo.GetBySessionID(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetBySessionID: %v", err)
+	}
+	if !login.LogoutTime.Valid || !login.LogoutTime.Time.Equal(logoutTime) {
+		t.Errorf("LogoutTime = %v, ожидалось %v", login.LogoutTime, logoutTime)
+	}
+
+	if err := repo.UpdateLogoutTime(ctx, "missing", logoutTime); !errors.Is(err, db.ErrLoginNotFound) {
+		t.Errorf("UpdateLogoutTime(missing): ошибка %v, ожидалась ErrLoginNotFound", err)
+	}
+}
+
+func testGetLastUserLogins(t *testing.T, ctx context.Context, repo db.UserLoginRepository) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	// Вставка не по порядку времени: сортировка должна идти по login_time
+	for _, minutes := range []int{10, 30, 20, 40} {
+		session := fmt.Sprintf("s%d", minutes)
+		if err := repo.Save(ctx, "u1", "alice", "", "", session, base.Add(time.Duration(minutes)*time.Minute), true, ""); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if err := repo.Save(ctx, "u2", "bob", "", "", "other", base.Add(time.Hour), true, ""); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	logins, err := repo.GetLastUserLogins(ctx, "u1", 3)
+	if err != nil {
+		t.Fatalf("GetLastUserLogins: %v", err)
+	}
+	var sessions []string
+	for _, l := range logins {
+		sessions = append(sessions, l.SessionID)
+	}
+	if fmt.Sprint(sessions) != "[s40 s30 s20]" {
+		t.Errorf("GetLastUserLogins(u1, 3) = %v, ожидалось [s40 s30 s20]", sessions)
+	}
+
+	none, err := repo.GetLastUserLogins(ctx, "missing", 10)
+	if err != nil || len(none) != 0 {
+		t.Errorf("GetLastUserLogins(missing) = %d записей, %v", len(none), err)
+	}
+}
+
+func testGetUserLoginsPage(t *testing.T, ctx context.Context, repo db.UserLoginRepository) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	// Два входа в одно время: порядок между ними задаёт id
+	offsets := []int{10, 30, 20, 20, 40}
+	for i, minutes := range offsets {
+		if err := repo.Save(ctx, "u1", "alice", "", "", fmt.Sprint(i), base.Add(time.Duration(minutes)*time.Minute), true, ""); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if err := repo.Save(ctx, "u2", "bob", "", "", "other", base, true, ""); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var all []*db.UserLogin
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(offsets) {
+			t.Fatalf("пагинация не завершилась за %d страниц", pages)
+		}
+		page, err := repo.GetUserLoginsPage(ctx, "u1", 2, cursor)
+		if err != nil {
+			t.Fatalf("GetUserLoginsPage: %v", err)
+		}
+		all = append(all, page.Logins...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if len(all) != len(offsets) {
+		t.Fatalf("обход вернул %d записей, ожидалось %d", len(all), len(offsets))
+	}
+	seen := map[string]bool{}
+	for i, l := range all {
+		if seen[l.ID] || l.UserID != "u1" {
+			t.Errorf("лишняя или повторная запись %+v", l)
+		}
+		seen[l.ID] = true
+		if i > 0 {
+			prev := all[i-1]
+			if l.LoginTime.After(prev.LoginTime) || l.LoginTime.Equal(prev.LoginTime) && l.ID > prev.ID {
+				t.Errorf("порядок нарушен: %v после %v, ожидалось (login_time, id) DESC", l.LoginTime, prev.LoginTime)
+			}
+		}
+	}
+
+	// Страница ровно до конца выборки не возвращает курсор
+	page, err := repo.GetUserLoginsPage(ctx, "u1", len(offsets), "")
+	if err != nil {
+		t.Fatalf("GetUserLoginsPage: %v", err)
+	}
+	if len(page.Logins) != len(offsets) || page.NextCursor != "" {
+		t.Errorf("GetUserLoginsPage(limit=%d) = %d записей, курсор %q", len(offsets), len(page.Logins), page.NextCursor)
+	}
+}
+
+func testGetFailedLogins(t *testing.T, ctx context.Context, repo db.UserLoginRepository) {
+	since := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	records := []struct {
+		username string
+		at       time.Time
+		success  bool
+	}{
+		{"alice", since.Add(-time.Minute), false}, // до окна
+		{"alice", since, false},                   // граница не включается
+		{"alice", since.Add(time.Minute), false},
+		{"alice", since.Add(2 * time.Minute), false},
+		{"alice", since.Add(3 * time.Minute), true},
+		{"bob", since.Add(time.Minute), false},
+		// Варианты имени после нормализации — тот же пользователь
+		{"Alice", since.Add(4 * time.Minute), false},
+		{" ALICE ", since.Add(5 * time.Minute), false},
+		{"ａｌｉｃｅ", since.Add(6 * time.Minute), false},
+	}
+	for i, r := range records {
+		if err := repo.Save(ctx, "", r.username, "", "", fmt.Sprint(i), r.at, r.success, "bad password"); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	for _, username := range []string{"alice", "ALICE", "ａｌｉｃｅ"} {
+		count, err := repo.GetFailedLogins(ctx, username, since)
+		if err != nil {
+			t.Fatalf("GetFailedLogins: %v", err)
+		}
+		if count != 5 {
+			t.Errorf("GetFailedLogins(%q) = %d, ожидалось 5", username, count)
+		}
+	}
+
+	login, err := repo.GetBySessionID(ctx, "6")
+	if err != nil || login.Username != "alice" {
+		t.Errorf("GetBySessionID(6) = %+v, %v; ожидался username alice", login, err)
+	}
+}
+
+func testCleanupOldRecords(t *testing.T, ctx context.Context, repo db.UserLoginRepository) {
+	before := time.Now().Add(-24 * time.Hour).Truncate(time.Microsecond)
+	for i, at := range []time.Time{before.Add(-time.Hour), before.Add(-time.Minute), before, before.Add(time.Hour)} {
+		if err := repo.Save(ctx, "u1", "alice", "", "", fmt.Sprint(i), at, true, ""); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	removed, err := repo.CleanupOldRecords(ctx, before)
+	if err != nil {
+		t.Fatalf("CleanupOldRecords: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("CleanupOldRecords удалил %d записей, ожидалось 2", removed)
+	}
+
+	logins, err := repo.GetLastUserLogins(ctx, "u1", 10)
+	if err != nil {
+		t.Fatalf("GetLastUserLogins: %v", err)
+	}
+	if len(logins) != 2 {
+		t.Errorf("после очистки осталось %d записей, ожидалось 2", len(logins))
+	}
+}
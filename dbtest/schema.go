@@ -0,0 +1,170 @@
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// DSNEnv — переменная окружения с DSN тестовой базы PostgreSQL
+const DSNEnv = "VIRA_DB_TEST_DSN"
+
+// cleanupTimeout ограничивает удаление схемы после теста
+const cleanupTimeout = 30 * time.Second
+
+// DSN возвращает DSN тестовой базы из DSNEnv или пропускает тест, если он не задан
+func DSN(t testing.TB) string {
+	t.Helper()
+
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s не задан, тест с PostgreSQL пропущен", DSNEnv)
+	}
+	return dsn
+}
+
+// Schema — отдельная схема PostgreSQL с применёнными миграциями пакета db.
+// Пул DB открыт с search_path, указывающим на схему, поэтому репозитории и
+// миграции работают в ней, не видя таблиц других тестов.
+type Schema struct {
+	Name       string
+	DB         *sql.DB
+	Users      db.UserRepository
+	UserLogins db.UserLoginRepository
+}
+
+// NewSchema создаёт схему со случайным именем, применяет к ней миграции и
+// удаляет её вместе с данными в t.Cleanup
+func NewSchema(t testing.TB, dsn string) *Schema {
+	t.Helper()
+
+	s, err := Open(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("dbtest: %v", err)
+		}
+	})
+	return s
+}
+
+// Open создаёт схему так же, как NewSchema, но без привязки к тесту — например,
+// в TestMain для схемы, общей для тестов в режиме Begin. Схему удаляет Close.
+func Open(ctx context.Context, dsn string) (*Schema, error) {
+	name, err := schemaName()
+	if err != nil {
+		return nil, err
+	}
+
+	scopedDSN, err := withSearchPath(dsn, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := sql.Open("postgres", scopedDSN)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть пул: %w", err)
+	}
+
+	if _, err := pool.ExecContext(ctx, "CREATE SCHEMA "+pq.QuoteIdentifier(name)); err != nil {
+		_ = pool.Close()
+		return nil, fmt.Errorf("не удалось создать схему %s: %w", name, db.ClassifyError(err))
+	}
+
+	s := &Schema{
+		Name:       name,
+		DB:         pool,
+		Users:      db.NewUserRepository(pool),
+		UserLogins: db.NewUserLoginRepository(pool),
+	}
+
+	if err := db.Migrate(ctx, pool); err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("не удалось применить миграции в схеме %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Close удаляет схему со всеми данными и закрывает пул
+func (s *Schema) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	_, dropErr := s.DB.ExecContext(ctx, "DROP SCHEMA IF EXISTS "+pq.QuoteIdentifier(s.Name)+" CASCADE")
+	closeErr := s.DB.Close()
+
+	if dropErr != nil {
+		return fmt.Errorf("не удалось удалить схему %s: %w", s.Name, db.ClassifyError(dropErr))
+	}
+	return closeErr
+}
+
+// Tx — транзакция в схеме, откатываемая после теста, и репозитории, работающие в ней
+type Tx struct {
+	Tx         *sql.Tx
+	Users      db.UserRepository
+	UserLogins db.UserLoginRepository
+}
+
+// Begin открывает транзакцию, которая откатывается в t.Cleanup, так что тест
+// не оставляет данных в общей схеме. Ошибка любого запроса прерывает
+// транзакцию PostgreSQL, поэтому после ожидаемой ошибки тест не может
+// продолжать работу с базой.
+func (s *Schema) Begin(t testing.TB) *Tx {
+	t.Helper()
+
+	tx, err := s.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("dbtest: не удалось начать транзакцию: %v", db.ClassifyError(err))
+	}
+	t.Cleanup(func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			t.Errorf("dbtest: не удалось откатить транзакцию: %v", err)
+		}
+	})
+
+	return &Tx{
+		Tx:         tx,
+		Users:      s.Users.WithTx(tx),
+		UserLogins: s.UserLogins.WithTx(tx),
+	}
+}
+
+// schemaName возвращает случайное имя схемы
+func schemaName() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("не удалось сгенерировать имя схемы: %w", err)
+	}
+	return "vira_test_" + hex.EncodeToString(b[:]), nil
+}
+
+// withSearchPath добавляет search_path к DSN в форме URL или key=value;
+// lib/pq передаёт его серверу как параметр каждого нового соединения
+func withSearchPath(dsn, schema string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("некорректный DSN: %w", err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	return strings.TrimSpace(dsn) + " search_path=" + schema, nil
+}
@@ -3,13 +3,31 @@ package db
 import "errors"
 
 var (
-	ErrUserExists         = errors.New("пользователь уже существует")
-	ErrNoUser             = errors.New("пользователь не найден")
-	ErrInvalidCredentials = errors.New("неверные учетные данные")
-	ErrUserDisabled       = errors.New("пользователь отключен/заблокирован")
-	ErrUserNotFound       = errors.New("пользователь не найден")
-	ErrDuplicateUsername  = errors.New("пользователь уже существует")
-	ErrDuplicateEmail     = errors.New("email уже зарегистрирован")
-	ErrDBNotInitialized   = errors.New("база данных не инициализирована")
-	ErrDBConnectionLost   = errors.New("потеряно соединение с базой данных")
+	ErrUserExists            = errors.New("пользователь уже существует")
+	ErrNoUser                = errors.New("пользователь не найден")
+	ErrInvalidCredentials    = errors.New("неверные учетные данные")
+	ErrUserDisabled          = errors.New("пользователь отключен/заблокирован")
+	ErrUserNotFound          = errors.New("пользователь не найден")
+	ErrDuplicateUsername     = errors.New("пользователь уже существует")
+	ErrDuplicateEmail        = errors.New("email уже зарегистрирован")
+	ErrDBNotInitialized      = errors.New("база данных не инициализирована")
+	ErrDBConnectionLost      = errors.New("потеряно соединение с базой данных")
+	ErrUniqueViolation       = errors.New("нарушено ограничение уникальности")
+	ErrForeignKeyViolation   = errors.New("нарушено ограничение внешнего ключа")
+	ErrCheckViolation        = errors.New("нарушено ограничение CHECK")
+	ErrNotNullViolation      = errors.New("нарушено ограничение NOT NULL")
+	ErrSerializationFailure  = errors.New("ошибка сериализации транзакции")
+	ErrDeadlock              = errors.New("обнаружена взаимоблокировка")
+	ErrCircuitOpen           = errors.New("выключатель разомкнут, обращения к БД временно отклоняются")
+	ErrShuttingDown          = errors.New("база данных останавливается")
+	ErrInvalidMigration      = errors.New("некорректная миграция")
+	ErrMigrationExists       = errors.New("миграция с такой версией уже зарегистрирована")
+	ErrMetricsNameTaken      = errors.New("имя экземпляра уже используется в реестре метрик")
+	ErrInvalidCursor         = errors.New("некорректный курсор пагинации")
+	ErrConcurrentUpdate      = errors.New("запись изменена другим запросом")
+	ErrUserCollision         = errors.New("username или email пользователей совпадают после нормализации")
+	ErrConfirmTokenInvalid   = errors.New("неверный токен подтверждения")
+	ErrConfirmTokenExpired   = errors.New("срок действия токена подтверждения истёк")
+	ErrConfirmTokenThrottled = errors.New("токен подтверждения запрошен слишком часто")
+	ErrUserAlreadyConfirmed  = errors.New("пользователь уже подтверждён")
 )
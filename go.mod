@@ -6,6 +6,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/skrolikov/vira-config v1.0.1
 	github.com/skrolikov/vira-logger v1.0.1
+	golang.org/x/text v0.28.0
 )
 
 require (
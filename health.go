@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// MonitorResult — результат одной фоновой проверки соединения
+type MonitorResult struct {
+	Time    time.Time     `json:"time"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// HealthReport — подробный отчёт о состоянии подключения к БД
+type HealthReport struct {
+	Status         string          `json:"status"` // ok, degraded или down
+	State          string          `json:"state"`  // состояние мониторинга соединения
+	PingLatency    time.Duration   `json:"ping_latency"`
+	PingError      string          `json:"ping_error,omitempty"`
+	Pool           *DBStats        `json:"pool"`
+	PoolSaturation float64         `json:"pool_saturation"` // доля занятых соединений от MaxOpenConnections
+	SchemaVersion  int64           `json:"schema_version"`
+	SchemaError    string          `json:"schema_error,omitempty"`
+	Replicas       []ReplicaStatus `json:"replicas,omitempty"`
+	RecentChecks   []MonitorResult `json:"recent_checks"`
+	CheckedAt      time.Time       `json:"checked_at"`
+}
+
+// WithHealthHistory задаёт, сколько последних результатов мониторинга хранить для HealthReport
+func WithHealthHistory(n int) Option {
+	return func(o *options) { o.healthHistory = n }
+}
+
+// recordCheck сохраняет результат фоновой проверки в кольцевой истории
+func (d *DB) recordCheck(start time.Time, err error) {
+	if d.opts.healthHistory <= 0 {
+		return
+	}
+
+	result := MonitorResult{Time: start, Latency: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	d.historyMu.Lock()
+	defer d.historyMu.Unlock()
+
+	d.history = append(d.history, result)
+	if extra := len(d.history) - d.opts.healthHistory; extra > 0 {
+		d.history = append(d.history[:0], d.history[extra:]...)
+	}
+}
+
+// recentChecks возвращает копию истории проверок, от старых к новым
+func (d *DB) recentChecks() []MonitorResult {
+	d.historyMu.Lock()
+	defer d.historyMu.Unlock()
+	return append([]MonitorResult(nil), d.history...)
+}
+
+// HealthReport собирает подробный отчёт о состоянии подключения
+func (d *DB) HealthReport(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		State:        d.State().String(),
+		Pool:         d.Stats(),
+		Replicas:     d.Replicas(),
+		RecentChecks: d.recentChecks(),
+		CheckedAt:    time.Now(),
+	}
+
+	if report.Pool.MaxOpenConnections > 0 {
+		report.PoolSaturation = float64(report.Pool.InUse) / float64(report.Pool.MaxOpenConnections)
+	}
+
+	start := time.Now()
+	pingErr := d.HealthCheck(ctx)
+	report.PingLatency = time.Since(start)
+
+	if pingErr != nil {
+		report.PingError = pingErr.Error()
+	} else {
+		version, err := SchemaVersion(ctx, d.SQL())
+		if err != nil {
+			report.SchemaError = err.Error()
+		}
+		report.SchemaVersion = version
+	}
+
+	switch {
+	case pingErr != nil || d.State() == StateDown:
+		report.Status = "down"
+	case d.State() != StateHealthy || report.SchemaError != "" || !replicasHealthy(report.Replicas):
+		report.Status = "degraded"
+	default:
+		report.Status = "ok"
+	}
+
+	return report
+}
+
+func replicasHealthy(replicas []ReplicaStatus) bool {
+	for _, r := range replicas {
+		if !r.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// LivenessHandler отвечает 200, пока экземпляр не закрыт. Доступность БД на
+// liveness не влияет: перезапуск процесса не вернёт базу.
+func (d *DB) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.closed.Load() {
+			writeHealthJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "closed"})
+			return
+		}
+		writeHealthJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+	})
+}
+
+// ReadinessHandler отвечает 200 с HealthReport, если БД доступна, и 503 в
+// состоянии down, с начала Shutdown и после закрытия экземпляра
+func (d *DB) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.closed.Load() {
+			writeHealthJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "closed"})
+			return
+		}
+		if d.inflight != nil && d.inflight.isDraining() {
+			writeHealthJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+			return
+		}
+
+		report := d.HealthReport(r.Context())
+		status := http.StatusOK
+		if report.Status == "down" {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealthJSON(w, status, report)
+	})
+}
+
+// LivenessHandler возвращает liveness-обработчик соединения по умолчанию. Пока
+// соединение не создано или уже закрыто через Shutdown, он отвечает 200: без
+// БД процесс жив, и перезапуск этого не исправит.
+func LivenessHandler() http.Handler {
+	return defaultHandler(func(d *DB) http.Handler { return d.LivenessHandler() }, http.StatusOK)
+}
+
+// ReadinessHandler возвращает readiness-обработчик соединения по умолчанию.
+// Без соединения он отвечает 503.
+func ReadinessHandler() http.Handler {
+	return defaultHandler(func(d *DB) http.Handler { return d.ReadinessHandler() }, http.StatusServiceUnavailable)
+}
+
+// defaultHandler откладывает выбор экземпляра до запроса, чтобы обработчик
+// можно было зарегистрировать до Init. Без соединения по умолчанию отвечает
+// кодом missing.
+func defaultHandler(handler func(*DB) http.Handler, missing int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, err := Default()
+		if err != nil {
+			status := "down"
+			if missing == http.StatusOK {
+				status = "alive"
+			}
+			writeHealthJSON(w, missing, map[string]string{"status": status, "error": err.Error()})
+			return
+		}
+		handler(d).ServeHTTP(w, r)
+	})
+}
+
+func writeHealthJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil && logg != nil {
+		logg.Warn("⚠️ Не удалось отдать отчёт о состоянии БД: %v", err)
+	}
+}
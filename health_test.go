@@ -0,0 +1,37 @@
+package db
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultHandlersWithoutInstance(t *testing.T) {
+	mu.Lock()
+	saved := defaultDB
+	defaultDB = nil
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		defaultDB = saved
+		mu.Unlock()
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		want    int
+	}{
+		{"liveness", LivenessHandler(), http.StatusOK},
+		{"readiness", ReadinessHandler(), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("код ответа %d, ожидался %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
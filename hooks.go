@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// QueryEvent описывает один вызов метода репозитория. Значения параметров в
+// событие не попадают: среди них хэши паролей и токенов.
+type QueryEvent struct {
+	Repository string        // имя репозитория: users, user_logins
+	Operation  string        // имя метода без суффикса Context
+	SQL        string        // текст выполняемого запроса
+	ArgCount   int           // число параметров запроса
+	Start      time.Time     // момент начала
+	Duration   time.Duration // длительность (заполняется в AfterQuery)
+	Rows       int64         // число прочитанных или изменённых строк (в AfterQuery)
+	Err        error         // ошибка метода (в AfterQuery)
+}
+
+// QueryHook вызывается до и после каждого запроса репозиториев. Контекст,
+// возвращённый BeforeQuery, передаётся в запрос и в AfterQuery — через него
+// хук может связать начало и конец (например, span трассировки).
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, event QueryEvent) context.Context
+	AfterQuery(ctx context.Context, event QueryEvent)
+}
+
+// argsQueryHook — встроенный хук, которому нужны значения параметров
+// запроса. finish вызывает afterQueryArgs вместо AfterQuery; снаружи пакета
+// такой хук реализовать нельзя.
+type argsQueryHook interface {
+	afterQueryArgs(ctx context.Context, event QueryEvent, args []any)
+}
+
+var (
+	globalHooksMu sync.RWMutex
+	globalHooks   []QueryHook
+)
+
+// AddQueryHook регистрирует хук для всех репозиториев пакета
+func AddQueryHook(h QueryHook) {
+	globalHooksMu.Lock()
+	defer globalHooksMu.Unlock()
+	globalHooks = append(globalHooks, h)
+}
+
+// WithQueryHooks задаёт хуки для репозиториев, созданных через DB.Users/DB.UserLogins
+func WithQueryHooks(hooks ...QueryHook) Option {
+	return func(o *options) { o.hooks = append(o.hooks, hooks...) }
+}
+
+// instrumentation учитывает вызовы методов одного репозитория в метриках и хуках
+type instrumentation struct {
+	repo     string
+	db       *DB // владелец выключателя и учёта операций; nil для репозиториев над *sql.DB
+	metrics  *Metrics
+	hooks    []QueryHook
+	inflight *inflightTracker
+	breaker  *circuitBreaker
+}
+
+// queryObservation — незавершённое наблюдение за вызовом метода
+type queryObservation struct {
+	ctx        context.Context
+	in         instrumentation
+	hooks      []QueryHook
+	event      QueryEvent
+	args       []any
+	rows       int64
+	inflightID uint64
+	tracked    bool
+	admitted   bool
+	ticket     breakerTicket
+}
+
+// start начинает наблюдение за методом op и вызывает BeforeQuery хуков.
+// Ошибка означает, что выключатель или остановка экземпляра отклонили
+// обращение к БД; наблюдение при этом всё равно нужно завершить через finish.
+func (in instrumentation) start(ctx context.Context, op, query string, args ...any) (context.Context, *queryObservation, error) {
+	globalHooksMu.RLock()
+	hooks := make([]QueryHook, 0, len(globalHooks)+len(in.hooks))
+	hooks = append(hooks, globalHooks...)
+	globalHooksMu.RUnlock()
+	hooks = append(hooks, in.hooks...)
+
+	q := &queryObservation{
+		in:    in,
+		hooks: hooks,
+		args:  args,
+		event: QueryEvent{
+			Repository: in.repo,
+			Operation:  op,
+			SQL:        query,
+			ArgCount:   len(args),
+			Start:      time.Now(),
+		},
+	}
+	// Запросы внутри начатой транзакции допускаются и при остановке:
+	// Shutdown дожидается этой транзакции
+	_, inTx := txOwnedBy(ctx, in.db)
+	var rejected error
+	if in.inflight != nil {
+		q.inflightID, rejected = in.inflight.begin("query", in.repo+"."+op, inTx)
+		q.tracked = rejected == nil
+	}
+	for _, h := range hooks {
+		ctx = h.BeforeQuery(ctx, q.event)
+	}
+	q.ctx = ctx
+	if rejected != nil {
+		return ctx, q, rejected
+	}
+
+	// Транзакция из RunInTransaction уже допущена выключателем и отчитается
+	// о результате сама. Повторная проверка заняла бы ещё одно место пробы
+	// в полуоткрытом состоянии, и запросы внутри транзакции отклонялись бы.
+	if in.breaker != nil && !inTx {
+		ticket, err := in.breaker.allow()
+		if err != nil {
+			return ctx, q, err
+		}
+		q.admitted, q.ticket = true, ticket
+	}
+	return ctx, q, nil
+}
+
+// finish завершает наблюдение. Предназначен для вызова через defer: *errp
+// читается после выхода из метода.
+func (q *queryObservation) finish(errp *error) {
+	q.event.Duration = time.Since(q.event.Start)
+	q.event.Rows = q.rows
+	q.event.Err = *errp
+
+	if q.tracked {
+		q.in.inflight.end(q.inflightID)
+	}
+	if q.admitted {
+		q.in.breaker.done(q.ticket, q.event.Err)
+	}
+	if q.in.metrics != nil {
+		q.in.metrics.ObserveQuery(q.in.repo, q.event.Operation, q.event.Duration, q.event.Err)
+	}
+	for i := len(q.hooks) - 1; i >= 0; i-- {
+		if h, ok := q.hooks[i].(argsQueryHook); ok {
+			h.afterQueryArgs(q.ctx, q.event, q.args)
+			continue
+		}
+		q.hooks[i].AfterQuery(q.ctx, q.event)
+	}
+}
+
+// Span — минимальный интерфейс span трассировки, совместимый по смыслу с OpenTelemetry
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// Tracer открывает span, дочерний по отношению к span из ctx
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type spanContextKey struct{}
+
+// tracingHook превращает каждый вызов репозитория в span
+type tracingHook struct {
+	tracer Tracer
+}
+
+// NewTracingHook возвращает хук, открывающий span на каждый запрос репозиториев.
+// Span создаётся дочерним к span входящего HTTP-запроса из ctx, поэтому
+// запросы к БД попадают в ту же трассу.
+func NewTracingHook(t Tracer) QueryHook {
+	return tracingHook{tracer: t}
+}
+
+func (h tracingHook) BeforeQuery(ctx context.Context, event QueryEvent) context.Context {
+	ctx, span := h.tracer.Start(ctx, "db."+event.Repository+"."+event.Operation)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.operation", event.Operation)
+	span.SetAttribute("db.statement", event.SQL)
+	span.SetAttribute("db.vira.repository", event.Repository)
+	span.SetAttribute("db.vira.arg_count", event.ArgCount)
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+func (h tracingHook) AfterQuery(ctx context.Context, event QueryEvent) {
+	span, ok := ctx.Value(spanContextKey{}).(Span)
+	if !ok {
+		return
+	}
+	span.SetAttribute("db.vira.rows", event.Rows)
+	if event.Err != nil && !isNotFoundError(event.Err) && !isConfirmTokenError(event.Err) {
+		span.RecordError(event.Err)
+	}
+	span.End()
+}
+
+// isNotFoundError проверяет, что ошибка означает отсутствие записи, а не сбой
+func isNotFoundError(err error) bool {
+	return errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrLoginNotFound)
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+// recordingHook запоминает события, полученные хуком
+type recordingHook struct {
+	events []QueryEvent
+	args   [][]any
+}
+
+func (h *recordingHook) BeforeQuery(ctx context.Context, _ QueryEvent) context.Context { return ctx }
+
+func (h *recordingHook) AfterQuery(_ context.Context, event QueryEvent) {
+	h.events = append(h.events, event)
+}
+
+// recordingArgsHook получает параметры, как встроенный журнал медленных запросов
+type recordingArgsHook struct {
+	recordingHook
+}
+
+func (h *recordingArgsHook) afterQueryArgs(_ context.Context, event QueryEvent, args []any) {
+	h.events = append(h.events, event)
+	h.args = append(h.args, args)
+}
+
+func TestQueryArgsReachOnlyBuiltinHooks(t *testing.T) {
+	public, builtin := &recordingHook{}, &recordingArgsHook{}
+	in := instrumentation{repo: "users", hooks: []QueryHook{public, builtin}}
+
+	_, q, err := in.start(context.Background(), "UpdatePassword", "UPDATE users SET password_hash = $1 WHERE id = $2", "secret-hash", "id")
+	q.finish(&err)
+
+	if len(public.events) != 1 || public.events[0].ArgCount != 2 {
+		t.Fatalf("внешний хук получил %+v, ожидалось одно событие с ArgCount 2", public.events)
+	}
+	if len(builtin.args) != 1 || len(builtin.args[0]) != 2 || builtin.args[0][0] != "secret-hash" {
+		t.Fatalf("встроенный хук получил параметры %v", builtin.args)
+	}
+}
@@ -0,0 +1,52 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// issueToken записывает пользователю хэш нового токена со сроком из
+// db.DefaultConfirmTokenPolicy
+func issueToken(u *db.User, hash string, issued time.Time) {
+	u.ConfirmToken = hash
+	u.ConfirmTokenIssuedAt = sql.NullTime{Time: issued, Valid: true}
+	u.ConfirmTokenExpiresAt = sql.NullTime{Time: issued.Add(db.DefaultConfirmTokenPolicy.TTL).Round(time.Microsecond), Valid: true}
+}
+
+// RegenerateConfirmToken выпускает неподтверждённому пользователю новый
+// токен подтверждения, соблюдая db.DefaultConfirmTokenPolicy.ResendInterval
+func (r *UserRepository) RegenerateConfirmToken(ctx context.Context, email string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	token, err := db.NewConfirmToken()
+	if err != nil {
+		return "", err
+	}
+	email = r.normalizer().Email(email)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.findActive(func(u *db.User) bool { return u.Email == email })
+	if s == nil {
+		return "", db.ErrUserNotFound
+	}
+	if s.user.Confirmed {
+		return "", db.ErrUserAlreadyConfirmed
+	}
+
+	issued := now()
+	if s.user.ConfirmTokenIssuedAt.Valid {
+		next := s.user.ConfirmTokenIssuedAt.Time.Add(db.DefaultConfirmTokenPolicy.ResendInterval)
+		if issued.Before(next) {
+			return "", &db.ConfirmTokenThrottledError{RetryAfter: next.Sub(issued)}
+		}
+	}
+	issueToken(&s.user, db.HashConfirmToken(token), issued)
+	s.user.Version++
+	return token, nil
+}
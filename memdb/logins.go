@@ -0,0 +1,196 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+var _ db.UserLoginRepository = (*UserLoginRepository)(nil)
+
+// UserLoginRepository — реализация db.UserLoginRepository в памяти
+type UserLoginRepository struct {
+	mu     sync.RWMutex
+	logins []*db.UserLogin // в порядке вставки
+	norm   *db.Normalizer
+}
+
+// NewUserLoginRepository создает пустой репозиторий истории входов в памяти
+func NewUserLoginRepository() *UserLoginRepository {
+	return NewUserLoginRepositoryWithNormalizer(nil)
+}
+
+// NewUserLoginRepositoryWithNormalizer создает пустой репозиторий, приводящий
+// username к виду n; nil означает db.DefaultNormalizer
+func NewUserLoginRepositoryWithNormalizer(n *db.Normalizer) *UserLoginRepository {
+	return &UserLoginRepository{norm: n}
+}
+
+// normalizer возвращает нормализатор репозитория
+func (r *UserLoginRepository) normalizer() *db.Normalizer {
+	if r.norm == nil {
+		return db.DefaultNormalizer
+	}
+	return r.norm
+}
+
+// WithTx возвращает тот же репозиторий: транзакции в памяти не поддерживаются
+func (r *UserLoginRepository) WithTx(*sql.Tx) db.UserLoginRepository {
+	return r
+}
+
+// Save сохраняет информацию о входе пользователя
+func (r *UserLoginRepository) Save(
+	ctx context.Context,
+	userID, username, ip, userAgent, sessionID string,
+	loginTime time.Time,
+	success bool,
+	failReason string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var reason sql.NullString
+	if failReason != "" {
+		reason = sql.NullString{String: failReason, Valid: true}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logins = append(r.logins, &db.UserLogin{
+		ID:         newID(),
+		UserID:     userID,
+		Username:   r.normalizer().Username(username),
+		IP:         ip,
+		UserAgent:  userAgent,
+		LoginTime:  loginTime.Round(time.Microsecond),
+		SessionID:  sessionID,
+		Success:    success,
+		FailReason: reason,
+	})
+	return nil
+}
+
+// UpdateLogoutTime обновляет время выхода во всех записях сессии
+func (r *UserLoginRepository) UpdateLogoutTime(ctx context.Context, sessionID string, logoutTime time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	updated := 0
+	for _, l := range r.logins {
+		if l.SessionID == sessionID {
+			l.LogoutTime = sql.NullTime{Time: logoutTime.Round(time.Microsecond), Valid: true}
+			updated++
+		}
+	}
+	if updated == 0 {
+		return db.ErrLoginNotFound
+	}
+	return nil
+}
+
+// GetBySessionID возвращает запись о входе по идентификатору сессии
+func (r *UserLoginRepository) GetBySessionID(ctx context.Context, sessionID string) (*db.UserLogin, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, l := range r.logins {
+		if l.SessionID == sessionID {
+			login := *l
+			return &login, nil
+		}
+	}
+	return nil, db.ErrLoginNotFound
+}
+
+// GetLastUserLogins возвращает последние записи о входах пользователя
+func (r *UserLoginRepository) GetLastUserLogins(ctx context.Context, userID string, limit int) ([]*db.UserLogin, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkLimit(limit, 0); err != nil {
+		return nil, fmt.Errorf("failed to query user logins: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []*db.UserLogin
+	for i := len(r.logins) - 1; i >= 0; i-- {
+		if r.logins[i].UserID == userID {
+			matched = append(matched, r.logins[i])
+		}
+	}
+	// Стабильная сортировка оставляет более поздние вставки первыми при равном времени
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].LoginTime.After(matched[j].LoginTime) })
+
+	var logins []*db.UserLogin
+	for _, l := range matched {
+		if len(logins) == limit {
+			break
+		}
+		login := *l
+		logins = append(logins, &login)
+	}
+	return logins, nil
+}
+
+// GetFailedLogins возвращает количество неудачных попыток входа после since
+func (r *UserLoginRepository) GetFailedLogins(ctx context.Context, username string, since time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	username = r.normalizer().Username(username)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	since = since.Round(time.Microsecond)
+	count := 0
+	for _, l := range r.logins {
+		if l.Username == username && !l.Success && l.LoginTime.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CleanupOldRecords удаляет записи о входах раньше before
+func (r *UserLoginRepository) CleanupOldRecords(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before = before.Round(time.Microsecond)
+	kept := r.logins[:0]
+	var removed int64
+	for _, l := range r.logins {
+		if l.LoginTime.Before(before) {
+			removed++
+			continue
+		}
+		kept = append(kept, l)
+	}
+	clear(r.logins[len(kept):])
+	r.logins = kept
+	return removed, nil
+}
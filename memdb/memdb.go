@@ -0,0 +1,59 @@
+// Package memdb содержит потокобезопасные реализации репозиториев пакета db,
+// хранящие данные в памяти. Они воспроизводят поведение PostgreSQL-версий —
+// ошибки уникальности, подтверждение пользователя, порядок и пагинацию — и
+// предназначены для модульных тестов кода, зависящего от db.UserRepository и
+// db.UserLoginRepository. Соответствие проверяется набором dbtest.
+//
+// Транзакции не поддерживаются: WithTx возвращает тот же репозиторий, и
+// изменения не откатываются.
+package memdb
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// now возвращает текущее время с точностью PostgreSQL TIMESTAMPTZ
+func now() time.Time {
+	return time.Now().Round(time.Microsecond)
+}
+
+// newID возвращает случайный UUID версии 4, как gen_random_uuid()
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("memdb: не удалось сгенерировать UUID: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// uniqueViolation возвращает ту же ошибку, что и SQL-репозиторий при
+// нарушении ограничения constraint таблицы table
+func uniqueViolation(table, constraint, column, value string) error {
+	return db.ClassifyError(&pq.Error{
+		Severity:   "ERROR",
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Detail:     fmt.Sprintf("Key (%s)=(%s) already exists.", column, value),
+		Table:      table,
+		Constraint: constraint,
+	})
+}
+
+// checkLimit повторяет проверку LIMIT/OFFSET PostgreSQL
+func checkLimit(limit, offset int) error {
+	if limit < 0 {
+		return db.ClassifyError(&pq.Error{Severity: "ERROR", Code: "2201W", Message: "LIMIT must not be negative"})
+	}
+	if offset < 0 {
+		return db.ClassifyError(&pq.Error{Severity: "ERROR", Code: "2201X", Message: "OFFSET must not be negative"})
+	}
+	return nil
+}
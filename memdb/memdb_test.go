@@ -0,0 +1,21 @@
+package memdb_test
+
+import (
+	"testing"
+
+	db "github.com/skrolikov/vira-db"
+	"github.com/skrolikov/vira-db/dbtest"
+	"github.com/skrolikov/vira-db/memdb"
+)
+
+func TestMemoryUsers(t *testing.T) {
+	dbtest.RunUserRepositoryTests(t, func(*testing.T) db.UserRepository {
+		return memdb.NewUserRepository()
+	})
+}
+
+func TestMemoryUserLogins(t *testing.T) {
+	dbtest.RunUserLoginRepositoryTests(t, func(*testing.T) db.UserLoginRepository {
+		return memdb.NewUserLoginRepository()
+	})
+}
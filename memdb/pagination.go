@@ -0,0 +1,112 @@
+package memdb
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// before сравнивает ключи (time, id) так же, как сравнение строк в PostgreSQL
+func before(t time.Time, id string, c db.Cursor) bool {
+	if !t.Equal(c.Time) {
+		return t.Before(c.Time)
+	}
+	return id < c.ID
+}
+
+// descByKey упорядочивает по (time, id) от больших к меньшим
+func descByKey(ta time.Time, ida string, tb time.Time, idb string) int {
+	if c := tb.Compare(ta); c != 0 {
+		return c
+	}
+	return strings.Compare(idb, ida)
+}
+
+// GetUsersByRolePage возвращает страницу пользователей роли role по ключу
+// (created_at, id) от новых к старым
+func (r *UserRepository) GetUsersByRolePage(ctx context.Context, role string, limit int, cursor string) (*db.UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = db.DefaultSearchLimit
+	}
+
+	var after *db.Cursor
+	if cursor != "" {
+		c, err := db.DecodeCursor(db.CursorScopeUsersByRole, cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []*db.User
+	for _, s := range r.users {
+		if s.user.Role == role && visible(ctx, &s.user) && (after == nil || before(s.user.CreatedAt, s.user.ID, *after)) {
+			matched = append(matched, &s.user)
+		}
+	}
+	slices.SortFunc(matched, func(a, b *db.User) int { return descByKey(a.CreatedAt, a.ID, b.CreatedAt, b.ID) })
+
+	page := &db.UserPage{}
+	for _, u := range matched {
+		if len(page.Users) == limit {
+			last := page.Users[limit-1]
+			page.NextCursor = db.EncodeCursor(db.CursorScopeUsersByRole, db.Cursor{Time: last.CreatedAt, ID: last.ID})
+			break
+		}
+		user := *u
+		page.Users = append(page.Users, &user)
+	}
+	return page, nil
+}
+
+// GetUserLoginsPage возвращает страницу истории входов пользователя по ключу
+// (login_time, id) от последних к ранним
+func (r *UserLoginRepository) GetUserLoginsPage(ctx context.Context, userID string, limit int, cursor string) (*db.UserLoginPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = db.DefaultSearchLimit
+	}
+
+	var after *db.Cursor
+	if cursor != "" {
+		c, err := db.DecodeCursor(db.CursorScopeUserLogins, cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []*db.UserLogin
+	for _, l := range r.logins {
+		if l.UserID == userID && (after == nil || before(l.LoginTime, l.ID, *after)) {
+			matched = append(matched, l)
+		}
+	}
+	slices.SortFunc(matched, func(a, b *db.UserLogin) int { return descByKey(a.LoginTime, a.ID, b.LoginTime, b.ID) })
+
+	page := &db.UserLoginPage{}
+	for _, l := range matched {
+		if len(page.Logins) == limit {
+			last := page.Logins[limit-1]
+			page.NextCursor = db.EncodeCursor(db.CursorScopeUserLogins, db.Cursor{Time: last.LoginTime, ID: last.ID})
+			break
+		}
+		login := *l
+		page.Logins = append(page.Logins, &login)
+	}
+	return page, nil
+}
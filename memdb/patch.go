@@ -0,0 +1,60 @@
+package memdb
+
+import (
+	"context"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// UpdateUserFields изменяет только заданные в patch поля и возвращает
+// обновлённого пользователя
+func (r *UserRepository) UpdateUserFields(ctx context.Context, id string, patch db.UserPatch) (*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.users[id]
+	if !ok || s.user.DeletedAt.Valid {
+		return nil, db.ErrUserNotFound
+	}
+	if patch.Version != 0 && patch.Version != s.user.Version {
+		current := s.user
+		return nil, &db.ConcurrentUpdateError{Version: patch.Version, Current: &current}
+	}
+
+	updated := s.user
+	changed := false
+	if patch.Username != nil {
+		updated.Username, changed = r.normalizer().Username(*patch.Username), true
+	}
+	if patch.Email != nil {
+		updated.Email, changed = r.normalizer().Email(*patch.Email), true
+	}
+	if patch.Role != nil {
+		updated.Role, changed = *patch.Role, true
+	}
+	if patch.Confirmed != nil {
+		updated.Confirmed, changed = *patch.Confirmed, true
+	}
+	if patch.LastLoginAt != nil {
+		updated.LastLoginAt, changed = roundNullTime(*patch.LastLoginAt), true
+	}
+	if patch.PasswordChanged != nil {
+		updated.PasswordChanged, changed = roundNullTime(*patch.PasswordChanged), true
+	}
+
+	if changed {
+		if err := r.checkUnique(id, updated.Username, updated.Email); err != nil {
+			return nil, err
+		}
+		updated.UpdatedAt = now()
+		updated.Version++
+		s.user = updated
+	}
+
+	user := s.user
+	return &user, nil
+}
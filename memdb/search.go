@@ -0,0 +1,125 @@
+package memdb
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// SearchUsers возвращает страницу пользователей, подходящих под filter, и,
+// если запрошено, их общее число
+func (r *UserRepository) SearchUsers(ctx context.Context, filter db.UserFilter) (*db.UserSearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = db.DefaultSearchLimit
+	}
+	if err := checkLimit(limit, filter.Offset); err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	sorts := filter.Sort
+	if len(sorts) == 0 {
+		sorts = []db.UserSort{{Field: db.SortByCreatedAt, Desc: true}}
+	}
+	for _, s := range sorts {
+		if s.Field < db.SortByCreatedAt || s.Field > db.SortByLastLogin {
+			return nil, fmt.Errorf("failed to search users: unknown sort field %d", s.Field)
+		}
+	}
+
+	filter.UsernamePrefix = r.normalizer().Username(filter.UsernamePrefix)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []*db.User
+	for _, s := range r.users {
+		if visible(ctx, &s.user) && matchUser(&s.user, filter) {
+			matched = append(matched, &s.user)
+		}
+	}
+	slices.SortFunc(matched, func(a, b *db.User) int {
+		for _, s := range sorts {
+			if c := compareUsers(a, b, s); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	result := &db.UserSearchResult{Total: -1}
+	if filter.CountTotal {
+		result.Total = len(matched)
+	}
+	for i := filter.Offset; i < len(matched) && len(result.Users) < limit; i++ {
+		user := *matched[i]
+		result.Users = append(result.Users, &user)
+	}
+	return result, nil
+}
+
+// matchUser повторяет условия WHERE SQL-версии
+func matchUser(u *db.User, f db.UserFilter) bool {
+	switch {
+	case f.Role != "" && u.Role != f.Role:
+		return false
+	case f.Confirmed != nil && u.Confirmed != *f.Confirmed:
+		return false
+	case !f.CreatedFrom.IsZero() && u.CreatedAt.Before(f.CreatedFrom.Round(time.Microsecond)):
+		return false
+	case !f.CreatedTo.IsZero() && !u.CreatedAt.Before(f.CreatedTo.Round(time.Microsecond)):
+		return false
+	case !f.LastLoginFrom.IsZero() && (!u.LastLoginAt.Valid || u.LastLoginAt.Time.Before(f.LastLoginFrom.Round(time.Microsecond))):
+		return false
+	case !f.LastLoginTo.IsZero() && (!u.LastLoginAt.Valid || !u.LastLoginAt.Time.Before(f.LastLoginTo.Round(time.Microsecond))):
+		return false
+	case f.UsernamePrefix != "" && !strings.HasPrefix(u.Username, f.UsernamePrefix):
+		return false
+	case f.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(u.Email), "@"+strings.ToLower(f.EmailDomain)):
+		return false
+	}
+	return true
+}
+
+// compareUsers сравнивает пользователей по одному ключу сортировки так же,
+// как ORDER BY SQL-версии: строки побайтно, NULL last_login_at — последними
+func compareUsers(a, b *db.User, s db.UserSort) int {
+	var c int
+	switch s.Field {
+	case db.SortByCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case db.SortByUpdatedAt:
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	case db.SortByUsername:
+		c = strings.Compare(a.Username, b.Username)
+	case db.SortByEmail:
+		c = strings.Compare(a.Email, b.Email)
+	case db.SortByLastLogin:
+		if a.LastLoginAt.Valid != b.LastLoginAt.Valid {
+			// NULLS LAST не зависит от направления
+			return cmp.Compare(boolRank(a.LastLoginAt.Valid), boolRank(b.LastLoginAt.Valid))
+		}
+		c = a.LastLoginAt.Time.Compare(b.LastLoginAt.Time)
+	}
+	if s.Desc {
+		return -c
+	}
+	return c
+}
+
+// boolRank ставит заданные значения перед отсутствующими
+func boolRank(valid bool) int {
+	if valid {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,410 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+var _ db.UserRepository = (*UserRepository)(nil)
+
+// UserRepository — реализация db.UserRepository в памяти
+type UserRepository struct {
+	mu    sync.RWMutex
+	users map[string]*storedUser
+	seq   uint64
+	norm  *db.Normalizer
+}
+
+// storedUser хранит пользователя и порядковый номер вставки, который
+// разрешает совпадения created_at
+type storedUser struct {
+	user db.User
+	seq  uint64
+}
+
+// NewUserRepository создает пустой репозиторий пользователей в памяти
+func NewUserRepository() *UserRepository {
+	return NewUserRepositoryWithNormalizer(nil)
+}
+
+// NewUserRepositoryWithNormalizer создает пустой репозиторий, приводящий
+// username и email к виду n; nil означает db.DefaultNormalizer
+func NewUserRepositoryWithNormalizer(n *db.Normalizer) *UserRepository {
+	return &UserRepository{users: map[string]*storedUser{}, norm: n}
+}
+
+// normalizer возвращает нормализатор репозитория
+func (r *UserRepository) normalizer() *db.Normalizer {
+	if r.norm == nil {
+		return db.DefaultNormalizer
+	}
+	return r.norm
+}
+
+// WithTx возвращает тот же репозиторий: транзакции в памяти не поддерживаются
+func (r *UserRepository) WithTx(*sql.Tx) db.UserRepository {
+	return r
+}
+
+// find возвращает первого пользователя, удовлетворяющего match; вызывается под блокировкой
+func (r *UserRepository) find(match func(*db.User) bool) *storedUser {
+	for _, s := range r.users {
+		if match(&s.user) {
+			return s
+		}
+	}
+	return nil
+}
+
+// findActive возвращает первого не удалённого пользователя, удовлетворяющего match
+func (r *UserRepository) findActive(match func(*db.User) bool) *storedUser {
+	return r.find(func(u *db.User) bool { return !u.DeletedAt.Valid && match(u) })
+}
+
+// checkUnique проверяет уникальные индексы users_username_key и
+// users_email_key, действующие среди не удалённых пользователей, не учитывая
+// пользователя с идентификатором selfID
+func (r *UserRepository) checkUnique(selfID, username, email string) error {
+	if r.findActive(func(u *db.User) bool { return u.ID != selfID && u.Username == username }) != nil {
+		return uniqueViolation("users", "users_username_key", "username", username)
+	}
+	if r.findActive(func(u *db.User) bool { return u.ID != selfID && u.Email == email }) != nil {
+		return uniqueViolation("users", "users_email_key", "email", email)
+	}
+	return nil
+}
+
+// visible сообщает, видим ли пользователь методам чтения с контекстом ctx
+func visible(ctx context.Context, u *db.User) bool {
+	return !u.DeletedAt.Valid || db.DeletedUsersIncluded(ctx)
+}
+
+// get возвращает копию первого видимого пользователя, удовлетворяющего match
+func (r *UserRepository) get(ctx context.Context, match func(*db.User) bool) (*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s := r.find(func(u *db.User) bool { return visible(ctx, u) && match(u) })
+	if s == nil {
+		return nil, db.ErrUserNotFound
+	}
+	user := s.user
+	return &user, nil
+}
+
+// GetUserByIDContext возвращает пользователя по ID
+func (r *UserRepository) GetUserByIDContext(ctx context.Context, id string) (*db.User, error) {
+	return r.get(ctx, func(u *db.User) bool { return u.ID == id })
+}
+
+// GetUserByUsernameContext возвращает пользователя по нормализованному имени
+func (r *UserRepository) GetUserByUsernameContext(ctx context.Context, username string) (*db.User, error) {
+	username = r.normalizer().Username(username)
+	return r.get(ctx, func(u *db.User) bool { return u.Username == username })
+}
+
+// GetUserByEmailContext возвращает пользователя по нормализованному email
+func (r *UserRepository) GetUserByEmailContext(ctx context.Context, email string) (*db.User, error) {
+	email = r.normalizer().Email(email)
+	return r.get(ctx, func(u *db.User) bool { return u.Email == email })
+}
+
+// ExistsByUsernameContext проверяет существование пользователя с заданным именем
+func (r *UserRepository) ExistsByUsernameContext(ctx context.Context, username string) (bool, error) {
+	_, err := r.GetUserByUsernameContext(ctx, username)
+	if errors.Is(err, db.ErrUserNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ExistsByEmailContext проверяет существование пользователя с заданным email
+func (r *UserRepository) ExistsByEmailContext(ctx context.Context, email string) (bool, error) {
+	_, err := r.GetUserByEmailContext(ctx, email)
+	if errors.Is(err, db.ErrUserNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateUserExtendedContext создает нового пользователя с расширенными полями
+func (r *UserRepository) CreateUserExtendedContext(ctx context.Context, username, passwordHash, email, role string, confirmed bool, confirmToken string) (string, error) {
+	user, err := r.CreateUserExtendedReturning(ctx, username, passwordHash, email, role, confirmed, confirmToken)
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// CreateUserExtendedReturning создает пользователя и возвращает созданную запись
+func (r *UserRepository) CreateUserExtendedReturning(ctx context.Context, username, passwordHash, email, role string, confirmed bool, confirmToken string) (*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	username, email = r.normalizer().Username(username), r.normalizer().Email(email)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkUnique("", username, email); err != nil {
+		return nil, err
+	}
+
+	created := now()
+	r.seq++
+	user := db.User{
+		ID:           newID(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		Email:        email,
+		Role:         role,
+		Confirmed:    confirmed,
+		ConfirmToken: db.HashConfirmToken(confirmToken),
+		CreatedAt:    created,
+		UpdatedAt:    created,
+		Version:      1,
+	}
+	if confirmToken != "" {
+		issueToken(&user, user.ConfirmToken, created)
+	}
+	r.users[user.ID] = &storedUser{user: user, seq: r.seq}
+	return &user, nil
+}
+
+// UpdateUserContext обновляет данные пользователя, если user.Version совпадает
+// с текущей или ctx получен из db.WithoutVersionCheck, и обновляет *user
+func (r *UserRepository) UpdateUserContext(ctx context.Context, user *db.User) error {
+	updated, err := r.UpdateUserReturning(ctx, user)
+	if err != nil {
+		return err
+	}
+	*user = *updated
+	return nil
+}
+
+// UpdateUserReturning обновляет данные пользователя и возвращает обновлённую запись
+func (r *UserRepository) UpdateUserReturning(ctx context.Context, user *db.User) (*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.users[user.ID]
+	if !ok || s.user.DeletedAt.Valid {
+		return nil, db.ErrUserNotFound
+	}
+	if !db.VersionCheckSkipped(ctx) && s.user.Version != user.Version {
+		current := s.user
+		return nil, &db.ConcurrentUpdateError{Version: user.Version, Current: &current}
+	}
+	username, email := r.normalizer().Username(user.Username), r.normalizer().Email(user.Email)
+	if err := r.checkUnique(user.ID, username, email); err != nil {
+		return nil, err
+	}
+
+	s.user.Username = username
+	s.user.Email = email
+	s.user.Role = user.Role
+	s.user.Confirmed = user.Confirmed
+	s.user.UpdatedAt = now()
+	s.user.LastLoginAt = roundNullTime(user.LastLoginAt)
+	s.user.PasswordChanged = roundNullTime(user.PasswordChanged)
+	s.user.Version++
+
+	updated := s.user
+	return &updated, nil
+}
+
+// DeleteUserContext мягко удаляет пользователя по ID
+func (r *UserRepository) DeleteUserContext(ctx context.Context, id string) error {
+	_, err := r.DeleteUserReturning(ctx, id)
+	return err
+}
+
+// DeleteUserReturning мягко удаляет пользователя и возвращает удалённую запись
+func (r *UserRepository) DeleteUserReturning(ctx context.Context, id string) (*db.User, error) {
+	return r.mutate(ctx, id, func(u *db.User) {
+		deleted := now()
+		u.DeletedAt = sql.NullTime{Time: deleted, Valid: true}
+		u.UpdatedAt = deleted
+	})
+}
+
+// ConfirmUserContext подтверждает пользователя по email и токену
+func (r *UserRepository) ConfirmUserContext(ctx context.Context, email, token string) error {
+	_, err := r.ConfirmUserReturning(ctx, email, token)
+	return err
+}
+
+// ConfirmUserReturning подтверждает пользователя и возвращает обновлённую запись
+func (r *UserRepository) ConfirmUserReturning(ctx context.Context, email, token string) (*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	email = r.normalizer().Email(email)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.findActive(func(u *db.User) bool { return u.Email == email })
+	switch {
+	case s == nil:
+		return nil, db.ErrUserNotFound
+	case s.user.Confirmed:
+		return nil, db.ErrUserAlreadyConfirmed
+	case !db.ConfirmTokenMatches(s.user.ConfirmToken, token):
+		return nil, db.ErrConfirmTokenInvalid
+	case !s.user.ConfirmTokenExpiresAt.Time.After(now()):
+		return nil, db.ErrConfirmTokenExpired
+	}
+	s.user.Confirmed = true
+	s.user.ConfirmToken = ""
+	s.user.ConfirmTokenExpiresAt = sql.NullTime{}
+	s.user.Version++
+
+	user := s.user
+	return &user, nil
+}
+
+// UpdatePasswordContext обновляет хэш пароля пользователя
+func (r *UserRepository) UpdatePasswordContext(ctx context.Context, id, newHash string) error {
+	_, err := r.UpdatePasswordReturning(ctx, id, newHash)
+	return err
+}
+
+// UpdatePasswordReturning обновляет хэш пароля и возвращает обновлённую запись
+func (r *UserRepository) UpdatePasswordReturning(ctx context.Context, id, newHash string) (*db.User, error) {
+	return r.mutate(ctx, id, func(u *db.User) {
+		u.PasswordHash = newHash
+		u.PasswordChanged = sql.NullTime{Time: now(), Valid: true}
+	})
+}
+
+// mutate применяет change к не удалённому пользователю id, увеличивает
+// версию и возвращает копию результата
+func (r *UserRepository) mutate(ctx context.Context, id string, change func(*db.User)) (*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.users[id]
+	if !ok || s.user.DeletedAt.Valid {
+		return nil, db.ErrUserNotFound
+	}
+	change(&s.user)
+	s.user.Version++
+
+	user := s.user
+	return &user, nil
+}
+
+// GetUsersByRoleContext возвращает список пользователей с определенной ролью,
+// начиная с последних созданных
+func (r *UserRepository) GetUsersByRoleContext(ctx context.Context, role string, limit, offset int) ([]*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkLimit(limit, offset); err != nil {
+		return nil, fmt.Errorf("failed to query users by role: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []*storedUser
+	for _, s := range r.users {
+		if s.user.Role == role && visible(ctx, &s.user) {
+			matched = append(matched, s)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if !a.user.CreatedAt.Equal(b.user.CreatedAt) {
+			return a.user.CreatedAt.After(b.user.CreatedAt)
+		}
+		return a.seq > b.seq
+	})
+
+	var users []*db.User
+	for i := offset; i < len(matched) && len(users) < limit; i++ {
+		user := matched[i].user
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+// roundNullTime приводит время к точности PostgreSQL TIMESTAMPTZ
+func roundNullTime(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = t.Time.Round(time.Microsecond)
+	}
+	return t
+}
+
+// RestoreUser восстанавливает мягко удалённого пользователя
+func (r *UserRepository) RestoreUser(ctx context.Context, id string) error {
+	_, err := r.RestoreUserReturning(ctx, id)
+	return err
+}
+
+// RestoreUserReturning восстанавливает пользователя и возвращает восстановленную запись
+func (r *UserRepository) RestoreUserReturning(ctx context.Context, id string) (*db.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.users[id]
+	if !ok || !s.user.DeletedAt.Valid {
+		return nil, db.ErrUserNotFound
+	}
+	if err := r.checkUnique(id, s.user.Username, s.user.Email); err != nil {
+		return nil, err
+	}
+	s.user.DeletedAt = sql.NullTime{}
+	s.user.UpdatedAt = now()
+	s.user.Version++
+
+	user := s.user
+	return &user, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удалённых
+// раньше before, и возвращает их число
+func (r *UserRepository) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before = before.Round(time.Microsecond)
+	var removed int64
+	for id, s := range r.users {
+		if s.user.DeletedAt.Valid && s.user.DeletedAt.Time.Before(before) {
+			delete(r.users, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,87 @@
+package memdb
+
+import (
+	"context"
+
+	db "github.com/skrolikov/vira-db"
+)
+
+// Методы без контекста нужны для соответствия db.UserRepository и
+// делегируют вызов context-версиям с context.Background().
+
+// GetUserByID возвращает пользователя по ID
+//
+// Deprecated: используйте GetUserByIDContext.
+func (r *UserRepository) GetUserByID(id string) (*db.User, error) {
+	return r.GetUserByIDContext(context.Background(), id)
+}
+
+// GetUserByUsername возвращает пользователя по имени пользователя
+//
+// Deprecated: используйте GetUserByUsernameContext.
+func (r *UserRepository) GetUserByUsername(username string) (*db.User, error) {
+	return r.GetUserByUsernameContext(context.Background(), username)
+}
+
+// GetUserByEmail возвращает пользователя по email
+//
+// Deprecated: используйте GetUserByEmailContext.
+func (r *UserRepository) GetUserByEmail(email string) (*db.User, error) {
+	return r.GetUserByEmailContext(context.Background(), email)
+}
+
+// ExistsByUsername проверяет существование пользователя с заданным именем
+//
+// Deprecated: используйте ExistsByUsernameContext.
+func (r *UserRepository) ExistsByUsername(username string) (bool, error) {
+	return r.ExistsByUsernameContext(context.Background(), username)
+}
+
+// ExistsByEmail проверяет существование пользователя с заданным email
+//
+// Deprecated: используйте ExistsByEmailContext.
+func (r *UserRepository) ExistsByEmail(email string) (bool, error) {
+	return r.ExistsByEmailContext(context.Background(), email)
+}
+
+// CreateUserExtended создает нового пользователя с расширенными полями
+//
+// Deprecated: используйте CreateUserExtendedContext.
+func (r *UserRepository) CreateUserExtended(username, passwordHash, email, role string, confirmed bool, confirmToken string) (string, error) {
+	return r.CreateUserExtendedContext(context.Background(), username, passwordHash, email, role, confirmed, confirmToken)
+}
+
+// UpdateUser обновляет данные пользователя
+//
+// Deprecated: используйте UpdateUserContext.
+func (r *UserRepository) UpdateUser(user *db.User) error {
+	return r.UpdateUserContext(context.Background(), user)
+}
+
+// DeleteUser удаляет пользователя по ID
+//
+// Deprecated: используйте DeleteUserContext.
+func (r *UserRepository) DeleteUser(id string) error {
+	return r.DeleteUserContext(context.Background(), id)
+}
+
+// ConfirmUser подтверждает пользователя по email и токену
+//
+// Deprecated: используйте ConfirmUserContext.
+func (r *UserRepository) ConfirmUser(email, token string) error {
+	return r.ConfirmUserContext(context.Background(), email, token)
+}
+
+// UpdatePassword обновляет хэш пароля пользователя
+//
+// Deprecated: используйте UpdatePasswordContext.
+func (r *UserRepository) UpdatePassword(id, newHash string) error {
+	return r.UpdatePasswordContext(context.Background(), id, newHash)
+}
+
+// GetUsersByRole возвращает список пользователей с определенной ролью
+//
+// Deprecated: используйте GetUsersByRoleContext.
+func (r *UserRepository) GetUsersByRole(role string, limit, offset int) ([]*db.User, error) {
+	return r.GetUsersByRoleContext(context.Background(), role, limit, offset)
+}
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets — границы гистограммы длительности запросов в секундах
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultMetrics — реестр метрик, в который по умолчанию пишут все DB и репозитории пакета
+var DefaultMetrics = NewMetrics()
+
+// Metrics собирает статистику пулов и запросов репозиториев и отдаёт её в
+// текстовом формате Prometheus
+type Metrics struct {
+	mu      sync.Mutex
+	buckets []float64
+	queries map[methodKey]*methodStats
+	dbs     map[*DB]string
+}
+
+type methodKey struct {
+	repo   string
+	method string
+}
+
+type methodStats struct {
+	count   uint64
+	errors  map[string]uint64
+	buckets []uint64
+	sum     float64
+}
+
+// NewMetrics создаёт реестр метрик; без buckets используются DefaultBuckets
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	return &Metrics{
+		buckets: b,
+		queries: map[methodKey]*methodStats{},
+		dbs:     map[*DB]string{},
+	}
+}
+
+// WithMetrics задаёт реестр метрик экземпляра (по умолчанию DefaultMetrics); nil отключает метрики
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) { o.metrics = m }
+}
+
+// WithName задаёт имя экземпляра, используемое как метка db в метриках.
+// Экземпляры без имени получают метки "default", "default-2" и так далее;
+// заданное имя, уже занятое в том же реестре метрик, Open отклоняет.
+func WithName(name string) Option {
+	return func(o *options) { o.name = name }
+}
+
+// defaultInstanceName — метка db экземпляров, открытых без WithName
+const defaultInstanceName = "default"
+
+// register добавляет пул экземпляра в экспорт метрик. Одинаковые серии
+// vira_db_pool_* от двух пулов Prometheus не принимает, поэтому экземпляр без
+// имени получает первую свободную метку, а занятое имя, заданное через
+// WithName, отклоняется.
+func (m *Metrics) register(d *DB, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	taken := make(map[string]bool, len(m.dbs))
+	for other, n := range m.dbs {
+		if other != d {
+			taken[n] = true
+		}
+	}
+
+	if name == "" {
+		name = defaultInstanceName
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s-%d", defaultInstanceName, i)
+		}
+	} else if taken[name] {
+		return fmt.Errorf("%w: %q", ErrMetricsNameTaken, name)
+	}
+	m.dbs[d] = name
+	return nil
+}
+
+// unregister убирает пул экземпляра из экспорта метрик
+func (m *Metrics) unregister(d *DB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dbs, d)
+}
+
+// ObserveQuery учитывает выполнение метода репозитория
+func (m *Metrics) ObserveQuery(repo, method string, duration time.Duration, err error) {
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := methodKey{repo: repo, method: method}
+	st, ok := m.queries[key]
+	if !ok {
+		st = &methodStats{errors: map[string]uint64{}, buckets: make([]uint64, len(m.buckets))}
+		m.queries[key] = st
+	}
+
+	st.count++
+	st.sum += seconds
+	for i, le := range m.buckets {
+		if seconds <= le {
+			st.buckets[i]++
+		}
+	}
+	if err != nil {
+		st.errors[metricErrorClass(err)]++
+	}
+}
+
+// metricErrorClass возвращает значение метки class для ошибки
+func metricErrorClass(err error) string {
+	if errors.Is(err, sql.ErrNoRows) || isNotFoundError(err) {
+		return "not_found"
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return "circuit_open"
+	}
+	if errors.Is(err, ErrConcurrentUpdate) {
+		return "concurrent_update"
+	}
+	if isConfirmTokenError(err) {
+		return "confirm_token"
+	}
+	return ErrorClassOf(err).String()
+}
+
+// Handler возвращает http.Handler, отдающий метрики в текстовом формате Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := m.WriteTo(w); err != nil && logg != nil {
+			logg.Warn("⚠️ Не удалось отдать метрики БД: %v", err)
+		}
+	})
+}
+
+// MetricsHandler возвращает обработчик метрик реестра DefaultMetrics
+func MetricsHandler() http.Handler {
+	return DefaultMetrics.Handler()
+}
+
+type poolMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(*DBStats) float64
+}
+
+var poolMetrics = []poolMetric{
+	{"vira_db_pool_max_open_connections", "gauge", "Максимальное число открытых соединений.", func(s *DBStats) float64 { return float64(s.MaxOpenConnections) }},
+	{"vira_db_pool_open_connections", "gauge", "Число открытых соединений.", func(s *DBStats) float64 { return float64(s.OpenConnections) }},
+	{"vira_db_pool_in_use_connections", "gauge", "Число соединений, занятых запросами.", func(s *DBStats) float64 { return float64(s.InUse) }},
+	{"vira_db_pool_idle_connections", "gauge", "Число простаивающих соединений.", func(s *DBStats) float64 { return float64(s.Idle) }},
+	{"vira_db_pool_wait_count_total", "counter", "Сколько раз запрос ждал свободное соединение.", func(s *DBStats) float64 { return float64(s.WaitCount) }},
+	{"vira_db_pool_wait_duration_seconds_total", "counter", "Суммарное время ожидания свободного соединения.", func(s *DBStats) float64 { return s.WaitDuration.Seconds() }},
+	{"vira_db_pool_max_idle_closed_total", "counter", "Соединения, закрытые из-за MaxIdleConns.", func(s *DBStats) float64 { return float64(s.MaxIdleClosed) }},
+	{"vira_db_pool_max_lifetime_closed_total", "counter", "Соединения, закрытые из-за ConnMaxLifetime.", func(s *DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+}
+
+// WriteTo записывает все метрики в текстовом формате Prometheus
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	type namedDB struct {
+		name string
+		db   *DB
+	}
+	dbs := make([]namedDB, 0, len(m.dbs))
+	for d, name := range m.dbs {
+		dbs = append(dbs, namedDB{name: name, db: d})
+	}
+	keys := make([]methodKey, 0, len(m.queries))
+	for k := range m.queries {
+		keys = append(keys, k)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].name < dbs[j].name })
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].repo != keys[j].repo {
+			return keys[i].repo < keys[j].repo
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	// Статистика пула снимается вне блокировки реестра
+	stats := make([]*DBStats, len(dbs))
+	for i, d := range dbs {
+		stats[i] = d.db.Stats()
+	}
+	for _, pm := range poolMetrics {
+		if len(dbs) == 0 {
+			break
+		}
+		writeHeader(cw, pm.name, pm.kind, pm.help)
+		for i, d := range dbs {
+			fmt.Fprintf(cw, "%s{db=%s} %s\n", pm.name, quoteLabel(d.name), formatFloat(pm.value(stats[i])))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(keys) > 0 {
+		writeHeader(cw, "vira_db_queries_total", "counter", "Число вызовов методов репозиториев.")
+		for _, k := range keys {
+			fmt.Fprintf(cw, "vira_db_queries_total{%s} %d\n", k.labels(), m.queries[k].count)
+		}
+
+		writeHeader(cw, "vira_db_query_errors_total", "counter", "Число ошибок методов репозиториев по классам.")
+		for _, k := range keys {
+			st := m.queries[k]
+			classes := make([]string, 0, len(st.errors))
+			for class := range st.errors {
+				classes = append(classes, class)
+			}
+			sort.Strings(classes)
+			for _, class := range classes {
+				fmt.Fprintf(cw, "vira_db_query_errors_total{%s,class=%s} %d\n", k.labels(), quoteLabel(class), st.errors[class])
+			}
+		}
+
+		writeHeader(cw, "vira_db_query_duration_seconds", "histogram", "Длительность методов репозиториев.")
+		for _, k := range keys {
+			st := m.queries[k]
+			for i, le := range m.buckets {
+				fmt.Fprintf(cw, "vira_db_query_duration_seconds_bucket{%s,le=%s} %d\n", k.labels(), quoteLabel(formatFloat(le)), st.buckets[i])
+			}
+			fmt.Fprintf(cw, "vira_db_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.labels(), st.count)
+			fmt.Fprintf(cw, "vira_db_query_duration_seconds_sum{%s} %s\n", k.labels(), formatFloat(st.sum))
+			fmt.Fprintf(cw, "vira_db_query_duration_seconds_count{%s} %d\n", k.labels(), st.count)
+		}
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (k methodKey) labels() string {
+	return "repo=" + quoteLabel(k.repo) + ",method=" + quoteLabel(k.method)
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter запоминает число записанных байт и первую ошибку записи
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMetricsRegisterNames(t *testing.T) {
+	m := NewMetrics()
+	first, second, third := &DB{}, &DB{}, &DB{}
+
+	for _, d := range []*DB{first, second, third} {
+		if err := m.register(d, ""); err != nil {
+			t.Fatalf("register экземпляра без имени: %v", err)
+		}
+	}
+	if m.dbs[first] != "default" || m.dbs[second] != "default-2" || m.dbs[third] != "default-3" {
+		t.Fatalf("метки экземпляров без имени: %q, %q, %q", m.dbs[first], m.dbs[second], m.dbs[third])
+	}
+
+	if err := m.register(&DB{}, "primary"); err != nil {
+		t.Fatalf("register заданного имени: %v", err)
+	}
+	if err := m.register(&DB{}, "primary"); !errors.Is(err, ErrMetricsNameTaken) {
+		t.Fatalf("register занятого заданного имени: %v, ожидалась ErrMetricsNameTaken", err)
+	}
+	if err := m.register(&DB{}, "default-2"); !errors.Is(err, ErrMetricsNameTaken) {
+		t.Fatalf("register имени, занятого экземпляром без имени: %v", err)
+	}
+
+	// Освободившаяся метка достаётся следующему экземпляру без имени
+	m.unregister(second)
+	next := &DB{}
+	if err := m.register(next, ""); err != nil || m.dbs[next] != "default-2" {
+		t.Fatalf("register после unregister: %q, %v", m.dbs[next], err)
+	}
+}
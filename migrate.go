@@ -0,0 +1,309 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// migrationLockKey — ключ advisory lock, под которым выполняются миграции
+const migrationLockKey int64 = 0x7669726164620001
+
+// MaxReservedMigrationVersion — версии до этого значения включительно
+// зарезервированы за миграциями пакета. Сервисы регистрируют свои миграции
+// с версиями больше него.
+const MaxReservedMigrationVersion int64 = 999
+
+// Migration описывает одну версионированную миграцию схемы
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = map[int64]Migration{}
+)
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+func init() {
+	if err := registerMigrationsFS(embeddedMigrations, "migrations", true); err != nil {
+		panic(fmt.Sprintf("db: некорректные встроенные миграции: %v", err))
+	}
+}
+
+// RegisterMigration добавляет миграцию сервиса в общий раннер
+func RegisterMigration(m Migration) error {
+	if m.Version <= MaxReservedMigrationVersion {
+		return fmt.Errorf("%w: версия %d зарезервирована за пакетом db", ErrInvalidMigration, m.Version)
+	}
+	return addMigration(m)
+}
+
+// RegisterMigrationsFS регистрирует миграции из файлов вида NNNN_name.up.sql / NNNN_name.down.sql
+func RegisterMigrationsFS(fsys fs.FS, dir string) error {
+	return registerMigrationsFS(fsys, dir, false)
+}
+
+func registerMigrationsFS(fsys fs.FS, dir string, builtin bool) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать каталог миграций %q: %w", dir, err)
+	}
+
+	found := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidMigration, entry.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("не удалось прочитать миграцию %s: %w", entry.Name(), err)
+		}
+
+		m, ok := found[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			found[version] = m
+		} else if m.Name != match[2] {
+			return fmt.Errorf("%w: версия %d используется миграциями %q и %q", ErrInvalidMigration, version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	for _, m := range found {
+		if builtin {
+			if m.Version > MaxReservedMigrationVersion {
+				return fmt.Errorf("%w: версия %d вне зарезервированного диапазона", ErrInvalidMigration, m.Version)
+			}
+			if err := addMigration(*m); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := RegisterMigration(*m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addMigration(m Migration) error {
+	if m.Version <= 0 {
+		return fmt.Errorf("%w: версия должна быть положительной", ErrInvalidMigration)
+	}
+	if m.Up == "" {
+		return fmt.Errorf("%w: у миграции %d нет up-скрипта", ErrInvalidMigration, m.Version)
+	}
+
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	if existing, ok := migrations[m.Version]; ok {
+		return fmt.Errorf("%w: версия %d уже занята миграцией %q", ErrMigrationExists, m.Version, existing.Name)
+	}
+	migrations[m.Version] = m
+	return nil
+}
+
+// Migrations возвращает все зарегистрированные миграции по возрастанию версии
+func Migrations() []Migration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+
+	list := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+// Migrate применяет все ещё не применённые миграции. Параллельные вызовы
+// из разных процессов сериализуются через advisory lock.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	return withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range Migrations() {
+			if applied[m.Version] {
+				continue
+			}
+			if err := runMigration(ctx, conn, m, true); err != nil {
+				return err
+			}
+			if logg != nil {
+				logg.Info("📦 Применена миграция %d_%s", m.Version, m.Name)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown откатывает применённые миграции с версией больше target
+func MigrateDown(ctx context.Context, db *sql.DB, target int64) error {
+	return withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		list := Migrations()
+		for i := len(list) - 1; i >= 0; i-- {
+			m := list[i]
+			if m.Version <= target || !applied[m.Version] {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("%w: у миграции %d нет down-скрипта", ErrInvalidMigration, m.Version)
+			}
+			if err := runMigration(ctx, conn, m, false); err != nil {
+				return err
+			}
+			if logg != nil {
+				logg.Info("↩️ Откачена миграция %d_%s", m.Version, m.Name)
+			}
+		}
+		return nil
+	})
+}
+
+// SchemaVersion возвращает максимальную применённую версию миграций (0, если миграций не было)
+func SchemaVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	var version sql.NullInt64
+	err := db.QueryRowContext(ctx,
+		`SELECT MAX(version) FROM schema_migrations`,
+	).Scan(&version)
+	if err != nil {
+		if isUndefinedTableError(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("не удалось получить версию схемы: %w", err)
+	}
+	return version.Int64, nil
+}
+
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(*sql.Conn) error) error {
+	// Session-level advisory lock привязан к соединению, поэтому вся работа
+	// ведётся на одном выделенном соединении пула.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("не удалось получить соединение для миграций: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("не удалось захватить блокировку миграций: %w", err)
+	}
+	defer func() {
+		// Контекст вызова мог быть уже отменён — снимаем блокировку независимо от него
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	}()
+
+	_, err = conn.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("не удалось прочитать версию миграции: %w", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func runMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию миграции %d: %w", m.Version, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	script := m.Up
+	if !up {
+		script = m.Down
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("миграция %d_%s завершилась ошибкой: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+			m.Version, m.Name,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось обновить schema_migrations для %d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось зафиксировать миграцию %d: %w", m.Version, err)
+	}
+	return nil
+}
+
+// isUndefinedTableError проверяет, что ошибка вызвана отсутствием таблицы (SQLSTATE 42P01)
+func isUndefinedTableError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"testing/fstest"
+)
+
+// restoreMigrations возвращает реестр миграций к состоянию до теста
+func restoreMigrations(t *testing.T) {
+	t.Helper()
+	migrationsMu.RLock()
+	saved := maps.Clone(migrations)
+	migrationsMu.RUnlock()
+	t.Cleanup(func() {
+		migrationsMu.Lock()
+		migrations = saved
+		migrationsMu.Unlock()
+	})
+}
+
+func TestRegisterMigrationsFS(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		builtin bool
+		wantErr error
+	}{
+		{"valid", fstest.MapFS{
+			"m/1001_posts.up.sql":   file("CREATE TABLE posts ()"),
+			"m/1001_posts.down.sql": file("DROP TABLE posts"),
+			"m/README.md":           file("не миграция"),
+			"m/old/1002_x.up.sql":   file("SELECT 1"),
+		}, false, nil},
+		{"reserved version", fstest.MapFS{
+			"m/0999_posts.up.sql": file("CREATE TABLE posts ()"),
+		}, false, ErrInvalidMigration},
+		{"builtin out of range", fstest.MapFS{
+			"m/1000_posts.up.sql": file("CREATE TABLE posts ()"),
+		}, true, ErrInvalidMigration},
+		{"builtin version taken", fstest.MapFS{
+			"m/0001_again.up.sql": file("SELECT 1"),
+		}, true, ErrMigrationExists},
+		{"name mismatch", fstest.MapFS{
+			"m/1001_posts.up.sql":     file("CREATE TABLE posts ()"),
+			"m/1001_article.down.sql": file("DROP TABLE posts"),
+		}, false, ErrInvalidMigration},
+		{"missing up script", fstest.MapFS{
+			"m/1001_posts.down.sql": file("DROP TABLE posts"),
+		}, false, ErrInvalidMigration},
+		{"empty up script", fstest.MapFS{
+			"m/1001_posts.up.sql": file(""),
+		}, false, ErrInvalidMigration},
+		{"version out of int64", fstest.MapFS{
+			"m/99999999999999999999_posts.up.sql": file("SELECT 1"),
+		}, false, ErrInvalidMigration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreMigrations(t)
+
+			err := registerMigrationsFS(tt.files, "m", tt.builtin)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("registerMigrationsFS: %v, ожидалось %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			migrationsMu.RLock()
+			m, ok := migrations[1001]
+			_, nested := migrations[1002]
+			migrationsMu.RUnlock()
+			if !ok || m.Name != "posts" || m.Up != "CREATE TABLE posts ()" || m.Down != "DROP TABLE posts" {
+				t.Errorf("зарегистрирована миграция %+v", m)
+			}
+			if nested {
+				t.Error("зарегистрирована миграция из вложенного каталога")
+			}
+		})
+	}
+}
+
+func TestRegisterMigrationsFSMissingDir(t *testing.T) {
+	if err := RegisterMigrationsFS(fstest.MapFS{}, "missing"); err == nil {
+		t.Fatal("ожидалась ошибка для отсутствующего каталога")
+	}
+}
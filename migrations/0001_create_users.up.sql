@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS users (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username         TEXT NOT NULL,
+    password         TEXT NOT NULL,
+    email            TEXT NOT NULL,
+    role             TEXT NOT NULL DEFAULT 'user',
+    confirmed        BOOLEAN NOT NULL DEFAULT FALSE,
+    confirm_token    TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at    TIMESTAMPTZ,
+    password_changed TIMESTAMPTZ,
+    CONSTRAINT users_username_key UNIQUE (username),
+    CONSTRAINT users_email_key UNIQUE (email)
+);
+
+CREATE INDEX IF NOT EXISTS users_role_created_at_idx ON users (role, created_at DESC);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_logins (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     TEXT NOT NULL,
+    username    TEXT NOT NULL,
+    ip          TEXT NOT NULL DEFAULT '',
+    user_agent  TEXT NOT NULL DEFAULT '',
+    login_time  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    logout_time TIMESTAMPTZ,
+    session_id  TEXT NOT NULL DEFAULT '',
+    success     BOOLEAN NOT NULL,
+    fail_reason TEXT
+);
+
+CREATE INDEX IF NOT EXISTS user_logins_user_id_login_time_idx ON user_logins (user_id, login_time DESC);
+CREATE INDEX IF NOT EXISTS user_logins_username_login_time_idx ON user_logins (username, login_time) WHERE NOT success;
+CREATE INDEX IF NOT EXISTS user_logins_session_id_idx ON user_logins (session_id);
+CREATE INDEX IF NOT EXISTS user_logins_login_time_idx ON user_logins (login_time);
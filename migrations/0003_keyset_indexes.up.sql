@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS users_role_created_at_idx;
+CREATE INDEX IF NOT EXISTS users_role_created_at_id_idx ON users (role, created_at DESC, id DESC);
+
+DROP INDEX IF EXISTS user_logins_user_id_login_time_idx;
+CREATE INDEX IF NOT EXISTS user_logins_user_id_login_time_id_idx ON user_logins (user_id, login_time DESC, id DESC);
@@ -0,0 +1,24 @@
+-- Username и email уникальны без учёта регистра. Если среди не удалённых
+-- пользователей уже есть такие совпадения, миграция останавливается до
+-- создания индексов: найти их помогает FindUserCollisions, а после
+-- разрешения конфликтов хранимые значения приводит к общему виду NormalizeUsers.
+DO $$
+DECLARE
+    collisions BIGINT;
+BEGIN
+    SELECT count(*) INTO collisions FROM (
+        SELECT lower(username) FROM users WHERE deleted_at IS NULL GROUP BY 1 HAVING count(*) > 1
+        UNION ALL
+        SELECT lower(email) FROM users WHERE deleted_at IS NULL GROUP BY 1 HAVING count(*) > 1
+    ) c;
+    IF collisions > 0 THEN
+        RAISE EXCEPTION 'users: % username/email совпадают без учёта регистра', collisions
+            USING HINT = 'разрешите совпадения, найденные FindUserCollisions, и повторите миграцию';
+    END IF;
+END
+$$;
+
+DROP INDEX IF EXISTS users_username_key;
+DROP INDEX IF EXISTS users_email_key;
+CREATE UNIQUE INDEX users_username_key ON users (lower(username)) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_email_key ON users (lower(email)) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+-- Хэши нельзя вернуть в открытый вид: после отката неподтверждённым
+-- пользователям нужно выпустить новые токены
+ALTER TABLE users DROP COLUMN IF EXISTS confirm_token_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS confirm_token_issued_at;
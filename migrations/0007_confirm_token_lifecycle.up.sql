@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS confirm_token_issued_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS confirm_token_expires_at TIMESTAMPTZ;
+
+-- Открытые токены заменяются хэшами в формате HashConfirmToken. Время их
+-- выпуска неизвестно, поэтому срок отсчитывается от миграции и совпадает с
+-- DefaultConfirmTokenPolicy.TTL.
+UPDATE users
+SET confirm_token = encode(sha256(convert_to(confirm_token, 'UTF8')), 'hex'),
+    confirm_token_issued_at = created_at,
+    confirm_token_expires_at = NOW() + INTERVAL '72 hours'
+WHERE confirm_token <> '' AND NOT confirmed;
+
+UPDATE users SET confirm_token = '' WHERE confirm_token <> '' AND confirmed;
@@ -1,16 +1,79 @@
 package db
 
-// UserRepository определяет интерфейс для работы с пользователями
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UserRepository определяет интерфейс для работы с пользователями.
+// Если ctx несёт транзакцию RunInTransaction того же DB (или того же пула для
+// репозиториев из NewUserRepository), Context-методы выполняются в ней;
+// репозиторий из WithTx всегда работает в своей транзакции.
+// Мягко удалённые пользователи не видны методам чтения, если ctx не получен
+// из WithDeletedUsers.
 type UserRepository interface {
+	GetUserByIDContext(ctx context.Context, id string) (*User, error)
+	GetUserByUsernameContext(ctx context.Context, username string) (*User, error)
+	GetUserByEmailContext(ctx context.Context, email string) (*User, error)
+	ExistsByUsernameContext(ctx context.Context, username string) (bool, error)
+	ExistsByEmailContext(ctx context.Context, email string) (bool, error)
+	CreateUserExtendedContext(ctx context.Context, username, passwordHash, email, role string, confirmed bool, confirmToken string) (string, error)
+	// UpdateUserContext обновляет запись, если user.Version совпадает с текущей
+	// версией, иначе возвращает *ConcurrentUpdateError; без проверки версии —
+	// только с контекстом из WithoutVersionCheck
+	UpdateUserContext(ctx context.Context, user *User) error
+	DeleteUserContext(ctx context.Context, id string) error
+	ConfirmUserContext(ctx context.Context, email, token string) error
+	UpdatePasswordContext(ctx context.Context, id, newHash string) error
+	GetUsersByRoleContext(ctx context.Context, role string, limit, offset int) ([]*User, error)
+
+	// SearchUsers возвращает страницу пользователей по фильтру и, если запрошено, их общее число
+	SearchUsers(ctx context.Context, filter UserFilter) (*UserSearchResult, error)
+	// GetUsersByRolePage возвращает страницу пользователей роли по курсору (created_at, id)
+	GetUsersByRolePage(ctx context.Context, role string, limit int, cursor string) (*UserPage, error)
+	// UpdateUserFields изменяет только заданные поля и возвращает обновлённого пользователя
+	UpdateUserFields(ctx context.Context, id string, patch UserPatch) (*User, error)
+	// RestoreUser восстанавливает мягко удалённого пользователя
+	RestoreUser(ctx context.Context, id string) error
+	// RegenerateConfirmToken выпускает новый токен подтверждения и возвращает его
+	RegenerateConfirmToken(ctx context.Context, email string) (string, error)
+
+	// Варианты изменяющих методов, возвращающие итоговую запись (RETURNING).
+	// Если подходящей записи нет, возвращается ErrUserNotFound.
+	CreateUserExtendedReturning(ctx context.Context, username, passwordHash, email, role string, confirmed bool, confirmToken string) (*User, error)
+	// UpdateUserReturning проверяет user.Version так же, как UpdateUserContext
+	UpdateUserReturning(ctx context.Context, user *User) (*User, error)
+	DeleteUserReturning(ctx context.Context, id string) (*User, error)
+	ConfirmUserReturning(ctx context.Context, email, token string) (*User, error)
+	UpdatePasswordReturning(ctx context.Context, id, newHash string) (*User, error)
+	RestoreUserReturning(ctx context.Context, id string) (*User, error)
+	// PurgeDeletedUsers окончательно удаляет пользователей, удалённых раньше before
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+
+	// WithTx возвращает репозиторий, привязанный к транзакции tx
+	WithTx(tx *sql.Tx) UserRepository
+
+	// Deprecated: используйте GetUserByIDContext.
 	GetUserByID(id string) (*User, error)
+	// Deprecated: используйте GetUserByUsernameContext.
 	GetUserByUsername(username string) (*User, error)
+	// Deprecated: используйте GetUserByEmailContext.
 	GetUserByEmail(email string) (*User, error)
+	// Deprecated: используйте ExistsByUsernameContext.
 	ExistsByUsername(username string) (bool, error)
+	// Deprecated: используйте ExistsByEmailContext.
 	ExistsByEmail(email string) (bool, error)
+	// Deprecated: используйте CreateUserExtendedContext.
 	CreateUserExtended(username, passwordHash, email, role string, confirmed bool, confirmToken string) (string, error)
+	// Deprecated: используйте UpdateUserContext.
 	UpdateUser(user *User) error
+	// Deprecated: используйте DeleteUserContext.
 	DeleteUser(id string) error
+	// Deprecated: используйте ConfirmUserContext.
 	ConfirmUser(email, token string) error
+	// Deprecated: используйте UpdatePasswordContext.
 	UpdatePassword(id, newHash string) error
+	// Deprecated: используйте GetUsersByRoleContext.
 	GetUsersByRole(role string, limit, offset int) ([]*User, error)
 }
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// EmailRule приводит адрес конкретного почтового провайдера к каноническому
+// виду. Правило получает уже нормализованные локальную часть и домен и
+// возвращает их новые значения; адреса чужих доменов оно возвращает без изменений.
+type EmailRule func(local, domain string) (string, string)
+
+// Normalizer приводит username и email к виду, в котором они хранятся и
+// сравниваются: обрезает пробелы, применяет Unicode NFKC и переводит в нижний
+// регистр. К email после этого по порядку применяются EmailRules.
+//
+// Репозитории нормализуют значения при создании и изменении пользователя и
+// при поиске по username и email, поэтому «Bob@Example.com» и
+// «bob@example.com» — один и тот же адрес.
+type Normalizer struct {
+	EmailRules []EmailRule
+}
+
+// DefaultNormalizer используется репозиториями, для которых нормализатор не задан
+var DefaultNormalizer = &Normalizer{}
+
+// WithNormalizer задаёт нормализатор username и email для репозиториев DB
+// (по умолчанию DefaultNormalizer)
+func WithNormalizer(n *Normalizer) Option {
+	return func(o *options) { o.normalizer = n }
+}
+
+// Username возвращает каноническое имя пользователя
+func (n *Normalizer) Username(username string) string {
+	return fold(username)
+}
+
+// Email возвращает канонический email. Строка без @ только приводится к
+// общему виду: проверка формата адреса — задача вызывающего кода.
+func (n *Normalizer) Email(email string) string {
+	email = fold(email)
+	at := strings.LastIndexByte(email, '@')
+	if n == nil || at <= 0 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	for _, rule := range n.EmailRules {
+		local, domain = rule(local, domain)
+	}
+	return local + "@" + domain
+}
+
+// fold выполняет общую для username и email нормализацию
+func fold(s string) string {
+	return strings.ToLower(strings.TrimSpace(norm.NFKC.String(s)))
+}
+
+// PlusAddressing возвращает правило, отбрасывающее подадрес «+tag» в
+// локальной части адресов доменов domains
+func PlusAddressing(domains ...string) EmailRule {
+	set := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		set[fold(d)] = true
+	}
+	return func(local, domain string) (string, string) {
+		if set[domain] {
+			local = stripTag(local)
+		}
+		return local, domain
+	}
+}
+
+// GmailRule приводит googlemail.com к gmail.com, отбрасывает подадрес «+tag»
+// и точки в локальной части: Gmail доставляет такие письма в один ящик
+func GmailRule(local, domain string) (string, string) {
+	if domain != "gmail.com" && domain != "googlemail.com" {
+		return local, domain
+	}
+	return strings.ReplaceAll(stripTag(local), ".", ""), "gmail.com"
+}
+
+// stripTag отбрасывает всё, начиная с первого «+»
+func stripTag(local string) string {
+	if i := strings.IndexByte(local, '+'); i > 0 {
+		return local[:i]
+	}
+	return local
+}
@@ -0,0 +1,48 @@
+package db
+
+import "testing"
+
+func TestNormalizer(t *testing.T) {
+	gmail := &Normalizer{EmailRules: []EmailRule{GmailRule}}
+	plus := &Normalizer{EmailRules: []EmailRule{PlusAddressing("Example.COM")}}
+
+	tests := []struct {
+		name  string
+		n     *Normalizer
+		email bool // проверяется Email, иначе Username
+		in    string
+		want  string
+	}{
+		{"username trim and case", DefaultNormalizer, false, "  Alice ", "alice"},
+		{"username NFKC fullwidth", DefaultNormalizer, false, "Ａｌｉｃｅ", "alice"},
+		{"username NFKC ligature", DefaultNormalizer, false, "ﬁona", "fiona"},
+		{"username composed", DefaultNormalizer, false, "José", "josé"},
+		{"email case", DefaultNormalizer, true, " Bob@Example.COM ", "bob@example.com"},
+		{"email NFKC", DefaultNormalizer, true, "ｂｏｂ@example.com", "bob@example.com"},
+		{"email without rules keeps tag", DefaultNormalizer, true, "bob+news@gmail.com", "bob+news@gmail.com"},
+		{"email without at", DefaultNormalizer, true, " Not-An-Email ", "not-an-email"},
+		{"email leading at", gmail, true, "@gmail.com", "@gmail.com"},
+		{"nil normalizer", nil, true, "Bob+x@Gmail.com", "bob+x@gmail.com"},
+		{"gmail dots and tag", gmail, true, "J.Doe+news@Gmail.com", "jdoe@gmail.com"},
+		{"googlemail domain", gmail, true, "j.doe@googlemail.com", "jdoe@gmail.com"},
+		{"gmail other domain", gmail, true, "j.doe+x@example.com", "j.doe+x@example.com"},
+		{"gmail leading plus", gmail, true, "+tag@gmail.com", "+tag@gmail.com"},
+		{"plus addressing", plus, true, "bob+news@example.com", "bob@example.com"},
+		{"plus addressing keeps dots", plus, true, "b.ob+a+b@example.com", "b.ob@example.com"},
+		{"plus addressing other domain", plus, true, "bob+news@gmail.com", "bob+news@gmail.com"},
+		{"last at splits domain", plus, true, "a@b+c@example.com", "a@b@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if tt.email {
+				got = tt.n.Email(tt.in)
+			} else {
+				got = tt.n.Username(tt.in)
+			}
+			if got != tt.want {
+				t.Fatalf("нормализация %q = %q, ожидалось %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
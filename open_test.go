@@ -0,0 +1,23 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	config "github.com/skrolikov/vira-config"
+	db "github.com/skrolikov/vira-db"
+	"github.com/skrolikov/vira-db/dbtest"
+)
+
+func TestOpenTwoUnnamedInstances(t *testing.T) {
+	cfg := &config.Config{DBUrl: dbtest.DSN(t), DBMaxOpenConns: 2, DBMaxIdleConns: 1}
+	ctx := context.Background()
+
+	for i := range 2 {
+		d, err := db.Open(ctx, cfg)
+		if err != nil {
+			t.Fatalf("Open экземпляра %d без опций: %v", i+1, err)
+		}
+		t.Cleanup(func() { _ = d.Close() })
+	}
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// UserPage — страница пользователей keyset-пагинации
+type UserPage struct {
+	Users      []*User
+	NextCursor string // пустой на последней странице
+}
+
+// UserLoginPage — страница истории входов keyset-пагинации
+type UserLoginPage struct {
+	Logins     []*UserLogin
+	NextCursor string // пустой на последней странице
+}
+
+// GetUsersByRolePage возвращает страницу пользователей роли role по ключу
+// (created_at, id) от новых к старым. Пустой cursor — первая страница, далее
+// передаётся NextCursor предыдущей. В отличие от OFFSET, созданные между
+// запросами пользователи не сдвигают страницы. Если limit <= 0,
+// используется DefaultSearchLimit.
+func (r *userRepo) GetUsersByRolePage(ctx context.Context, role string, limit int, cursor string) (_ *UserPage, err error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	b := &userQuery{}
+	b.add("role = ?", role)
+	if !DeletedUsersIncluded(ctx) {
+		b.where = append(b.where, "deleted_at IS NULL")
+	}
+	if cursor != "" {
+		c, err := DecodeCursor(CursorScopeUsersByRole, cursor)
+		if err != nil {
+			return nil, err
+		}
+		b.where = append(b.where, fmt.Sprintf("(created_at, id) < (%s, %s::uuid)", b.next(c.Time), b.next(c.ID)))
+	}
+
+	// Лишняя запись показывает, есть ли следующая страница
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		` + b.whereClause() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + b.next(limit+1)
+
+	ctx, q, err := r.ins.start(ctx, "GetUsersByRolePage", query, b.args...)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := readerFor(ctx, r.conns).QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users by role: %w", ClassifyError(err))
+	}
+	defer rows.Close()
+
+	page := &UserPage{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", ClassifyError(err))
+		}
+		page.Users = append(page.Users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", ClassifyError(err))
+	}
+
+	if len(page.Users) > limit {
+		page.Users = page.Users[:limit]
+		last := page.Users[limit-1]
+		page.NextCursor = EncodeCursor(CursorScopeUsersByRole, Cursor{Time: last.CreatedAt, ID: last.ID})
+	}
+	q.rows = int64(len(page.Users))
+	return page, nil
+}
+
+// GetUserLoginsPage возвращает страницу истории входов пользователя по ключу
+// (login_time, id) от последних к ранним. Пустой cursor — первая страница,
+// далее передаётся NextCursor предыдущей. Если limit <= 0, используется
+// DefaultSearchLimit.
+func (r *UserLoginRepositoryImpl) GetUserLoginsPage(ctx context.Context, userID string, limit int, cursor string) (_ *UserLoginPage, err error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	b := &userQuery{}
+	b.add("user_id = ?", userID)
+	if cursor != "" {
+		c, err := DecodeCursor(CursorScopeUserLogins, cursor)
+		if err != nil {
+			return nil, err
+		}
+		b.where = append(b.where, fmt.Sprintf("(login_time, id) < (%s, %s::uuid)", b.next(c.Time), b.next(c.ID)))
+	}
+
+	query := `SELECT 
+			id, user_id, username, ip, user_agent, 
+			login_time, logout_time, session_id, success, fail_reason
+		FROM user_logins 
+		` + b.whereClause() + `
+		ORDER BY login_time DESC, id DESC
+		LIMIT ` + b.next(limit+1)
+
+	ctx, q, err := r.ins.start(ctx, "GetUserLoginsPage", query, b.args...)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := readerFor(ctx, r.conns).QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user logins: %w", ClassifyError(err))
+	}
+	defer rows.Close()
+
+	page := &UserLoginPage{}
+	for rows.Next() {
+		login := &UserLogin{}
+		err := rows.Scan(
+			&login.ID, &login.UserID, &login.Username, &login.IP, &login.UserAgent,
+			&login.LoginTime, &login.LogoutTime, &login.SessionID, &login.Success, &login.FailReason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan login record: %w", ClassifyError(err))
+		}
+		page.Logins = append(page.Logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", ClassifyError(err))
+	}
+
+	if len(page.Logins) > limit {
+		page.Logins = page.Logins[:limit]
+		last := page.Logins[limit-1]
+		page.NextCursor = EncodeCursor(CursorScopeUserLogins, Cursor{Time: last.LoginTime, ID: last.ID})
+	}
+	q.rows = int64(len(page.Logins))
+	return page, nil
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/lib/pq"
+)
+
+// ErrorClass — класс ошибки БД
+type ErrorClass int
+
+const (
+	ClassUnknown ErrorClass = iota
+	ClassUniqueViolation
+	ClassForeignKeyViolation
+	ClassCheckViolation
+	ClassNotNullViolation
+	ClassSerializationFailure
+	ClassDeadlock
+	ClassConnection
+)
+
+// String возвращает название класса ошибки
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassUniqueViolation:
+		return "unique_violation"
+	case ClassForeignKeyViolation:
+		return "foreign_key_violation"
+	case ClassCheckViolation:
+		return "check_violation"
+	case ClassNotNullViolation:
+		return "not_null_violation"
+	case ClassSerializationFailure:
+		return "serialization_failure"
+	case ClassDeadlock:
+		return "deadlock"
+	case ClassConnection:
+		return "connection"
+	default:
+		return "unknown"
+	}
+}
+
+// DBError — структурированная ошибка БД. errors.Is находит в ней как
+// исходную ошибку драйвера, так и доменную ошибку пакета (например,
+// ErrDuplicateUsername для нарушения users_username_key).
+type DBError struct {
+	Class      ErrorClass
+	Code       string // SQLSTATE
+	Constraint string
+	Table      string
+	Column     string
+	Message    string
+	Retryable  bool
+	Err        error
+
+	sentinel error
+}
+
+// Error возвращает доменное описание ошибки, если оно известно, иначе сообщение драйвера
+func (e *DBError) Error() string {
+	switch {
+	case e.sentinel == nil:
+		return e.Err.Error()
+	case e.Constraint != "":
+		return fmt.Sprintf("%s (%s)", e.sentinel.Error(), e.Constraint)
+	default:
+		return fmt.Sprintf("%s: %s", e.sentinel.Error(), e.Message)
+	}
+}
+
+// Unwrap позволяет errors.Is/errors.As находить исходную и доменную ошибки
+func (e *DBError) Unwrap() []error {
+	errs := make([]error, 0, 3)
+	if e.sentinel != nil {
+		errs = append(errs, e.sentinel)
+	}
+	if s := classSentinels[e.Class]; s != nil && s != e.sentinel {
+		errs = append(errs, s)
+	}
+	return append(errs, e.Err)
+}
+
+var (
+	constraintErrorsMu sync.RWMutex
+	constraintErrors   = map[string]error{
+		"users_username_key": ErrDuplicateUsername,
+		"users_email_key":    ErrDuplicateEmail,
+	}
+)
+
+// RegisterConstraintError связывает ограничение с доменной ошибкой, которую
+// вернёт errors.Is для его нарушений
+func RegisterConstraintError(constraint string, err error) {
+	constraintErrorsMu.Lock()
+	defer constraintErrorsMu.Unlock()
+	constraintErrors[constraint] = err
+}
+
+func constraintError(constraint string) error {
+	constraintErrorsMu.RLock()
+	defer constraintErrorsMu.RUnlock()
+	return constraintErrors[constraint]
+}
+
+var classSentinels = map[ErrorClass]error{
+	ClassUniqueViolation:      ErrUniqueViolation,
+	ClassForeignKeyViolation:  ErrForeignKeyViolation,
+	ClassCheckViolation:       ErrCheckViolation,
+	ClassNotNullViolation:     ErrNotNullViolation,
+	ClassSerializationFailure: ErrSerializationFailure,
+	ClassDeadlock:             ErrDeadlock,
+	ClassConnection:           ErrDBConnectionLost,
+}
+
+// ClassifyError преобразует ошибку драйвера в *DBError. Ошибки, не
+// относящиеся к БД (и nil), возвращаются без изменений.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		e := &DBError{
+			Code:       string(pqErr.Code),
+			Constraint: pqErr.Constraint,
+			Table:      pqErr.Table,
+			Column:     pqErr.Column,
+			Message:    pqErr.Message,
+			Err:        err,
+		}
+
+		switch {
+		case pqErr.Code == "23505":
+			e.Class = ClassUniqueViolation
+		case pqErr.Code == "23503":
+			e.Class = ClassForeignKeyViolation
+		case pqErr.Code == "23514":
+			e.Class = ClassCheckViolation
+		case pqErr.Code == "23502":
+			e.Class = ClassNotNullViolation
+		case pqErr.Code == "40001":
+			e.Class = ClassSerializationFailure
+			e.Retryable = true
+		case pqErr.Code == "40P01":
+			e.Class = ClassDeadlock
+			e.Retryable = true
+		case pqErr.Code.Class() == "08", pqErr.Code == "57P01", pqErr.Code == "57P02", pqErr.Code == "57P03":
+			e.Class = ClassConnection
+			e.Retryable = true
+		}
+
+		e.sentinel = classSentinels[e.Class]
+		if e.Constraint != "" {
+			if s := constraintError(e.Constraint); s != nil {
+				e.sentinel = s
+			}
+		}
+		return e
+	}
+
+	if isConnectionError(err) {
+		return &DBError{
+			Class:     ClassConnection,
+			Message:   err.Error(),
+			Retryable: true,
+			Err:       err,
+			sentinel:  ErrDBConnectionLost,
+		}
+	}
+
+	return err
+}
+
+// isConnectionError распознаёт сетевые ошибки, не дошедшие до Postgres
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// ErrorClassOf возвращает класс ошибки БД
+func ErrorClassOf(err error) ErrorClass {
+	var dbErr *DBError
+	if errors.As(ClassifyError(err), &dbErr) {
+		return dbErr.Class
+	}
+	return ClassUnknown
+}
+
+// IsRetryable сообщает, можно ли повторить операцию, завершившуюся ошибкой err
+func IsRetryable(err error) bool {
+	var dbErr *DBError
+	return errors.As(ClassifyError(err), &dbErr) && dbErr.Retryable
+}
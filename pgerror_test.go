@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		class     ErrorClass
+		retryable bool
+		is        []error // ошибки, которые должен находить errors.Is
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, ClassUniqueViolation, false, []error{ErrUniqueViolation}},
+		{"duplicate username", &pq.Error{Code: "23505", Constraint: "users_username_key"}, ClassUniqueViolation, false,
+			[]error{ErrDuplicateUsername, ErrUniqueViolation}},
+		{"duplicate email", &pq.Error{Code: "23505", Constraint: "users_email_key"}, ClassUniqueViolation, false,
+			[]error{ErrDuplicateEmail, ErrUniqueViolation}},
+		{"foreign key", &pq.Error{Code: "23503"}, ClassForeignKeyViolation, false, []error{ErrForeignKeyViolation}},
+		{"check", &pq.Error{Code: "23514"}, ClassCheckViolation, false, []error{ErrCheckViolation}},
+		{"not null", &pq.Error{Code: "23502"}, ClassNotNullViolation, false, []error{ErrNotNullViolation}},
+		{"serialization", &pq.Error{Code: "40001"}, ClassSerializationFailure, true, []error{ErrSerializationFailure}},
+		{"deadlock", &pq.Error{Code: "40P01"}, ClassDeadlock, true, []error{ErrDeadlock}},
+		{"connection failure", &pq.Error{Code: "08006"}, ClassConnection, true, []error{ErrDBConnectionLost}},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, ClassConnection, true, []error{ErrDBConnectionLost}},
+		{"cannot connect now", &pq.Error{Code: "57P03"}, ClassConnection, true, []error{ErrDBConnectionLost}},
+		{"syntax error", &pq.Error{Code: "42601"}, ClassUnknown, false, nil},
+		{"wrapped", fmt.Errorf("обёртка: %w", &pq.Error{Code: "40001"}), ClassSerializationFailure, true,
+			[]error{ErrSerializationFailure}},
+		{"bad conn", driver.ErrBadConn, ClassConnection, true, []error{ErrDBConnectionLost, driver.ErrBadConn}},
+		{"unexpected EOF", io.ErrUnexpectedEOF, ClassConnection, true, []error{ErrDBConnectionLost}},
+		{"canceled", context.Canceled, ClassUnknown, false, []error{context.Canceled}},
+		{"other", errors.New("ошибка приложения"), ClassUnknown, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifyError(tt.err)
+			if got := ErrorClassOf(err); got != tt.class {
+				t.Errorf("класс %s, ожидался %s", got, tt.class)
+			}
+			if got := IsRetryable(err); got != tt.retryable {
+				t.Errorf("IsRetryable = %v, ожидалось %v", got, tt.retryable)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("errors.Is не находит исходную ошибку в %v", err)
+			}
+			for _, target := range tt.is {
+				if !errors.Is(err, target) {
+					t.Errorf("errors.Is(%v, %v) = false", err, target)
+				}
+			}
+			if again := ClassifyError(err); again != err {
+				t.Errorf("повторная классификация изменила ошибку: %v", again)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorNil(t *testing.T) {
+	if err := ClassifyError(nil); err != nil {
+		t.Fatalf("ClassifyError(nil) = %v", err)
+	}
+}
+
+func TestRegisterConstraintError(t *testing.T) {
+	errTaken := errors.New("слаг занят")
+	RegisterConstraintError("posts_slug_key", errTaken)
+	t.Cleanup(func() {
+		constraintErrorsMu.Lock()
+		delete(constraintErrors, "posts_slug_key")
+		constraintErrorsMu.Unlock()
+	})
+
+	err := ClassifyError(&pq.Error{Code: "23505", Constraint: "posts_slug_key"})
+	if !errors.Is(err, errTaken) || !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("ошибка %v не находит зарегистрированную и классовую ошибки", err)
+	}
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ConnState — состояние соединения с БД с точки зрения мониторинга
+type ConnState int
+
+const (
+	StateHealthy   ConnState = iota // проверки проходят
+	StateDegraded                   // есть неудачные проверки, но порог не достигнут
+	StateDown                       // порог неудачных проверок достигнут, идёт переподключение
+	StateRecovered                  // БД снова отвечает, ожидается первая успешная проверка
+)
+
+// String возвращает название состояния
+func (s ConnState) String() string {
+	switch s {
+	case StateHealthy:
+		return "healthy"
+	case StateDegraded:
+		return "degraded"
+	case StateDown:
+		return "down"
+	case StateRecovered:
+		return "recovered"
+	default:
+		return "unknown"
+	}
+}
+
+// StateEvent описывает смену состояния соединения
+type StateEvent struct {
+	From    ConnState
+	To      ConnState
+	Err     error // последняя ошибка проверки или переподключения
+	Attempt int   // номер попытки переподключения (для StateDown/StateRecovered)
+	Time    time.Time
+}
+
+// ReconnectPolicy задаёт параметры обнаружения отказа и переподключения
+type ReconnectPolicy struct {
+	FailureThreshold int           // сколько неудачных проверок подряд считается отказом
+	InitialBackoff   time.Duration // задержка перед первой попыткой переподключения
+	MaxBackoff       time.Duration // верхняя граница задержки
+	Multiplier       float64       // множитель экспоненциального роста задержки
+	Jitter           float64       // доля случайного разброса задержки, от 0 до 1
+}
+
+// DefaultReconnectPolicy возвращает политику переподключения по умолчанию
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		FailureThreshold: 3,
+		InitialBackoff:   500 * time.Millisecond,
+		MaxBackoff:       30 * time.Second,
+		Multiplier:       2,
+		Jitter:           0.2,
+	}
+}
+
+// WithReconnectPolicy задаёт политику переподключения
+func WithReconnectPolicy(p ReconnectPolicy) Option {
+	return func(o *options) { o.reconnect = p }
+}
+
+// backoff возвращает задержку перед попыткой attempt (начиная с 1)
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= p.Multiplier
+		if delay >= float64(p.MaxBackoff) {
+			delay = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// State возвращает текущее состояние соединения
+func (d *DB) State() ConnState {
+	d.subsMu.Lock()
+	defer d.subsMu.Unlock()
+	return d.state
+}
+
+// Subscribe подписывает на события смены состояния. События не блокируют
+// мониторинг: если буфер канала заполнен, событие отбрасывается. Возвращаемая
+// функция отменяет подписку и закрывает канал.
+func (d *DB) Subscribe(buffer int) (<-chan StateEvent, func()) {
+	ch := make(chan StateEvent, buffer)
+
+	d.subsMu.Lock()
+	id := d.nextID
+	d.nextID++
+	if d.subs == nil {
+		close(ch)
+	} else {
+		d.subs[id] = ch
+	}
+	d.subsMu.Unlock()
+
+	return ch, func() {
+		d.subsMu.Lock()
+		defer d.subsMu.Unlock()
+		if sub, ok := d.subs[id]; ok {
+			delete(d.subs, id)
+			close(sub)
+		}
+	}
+}
+
+// setState переводит соединение в новое состояние и уведомляет подписчиков
+func (d *DB) setState(to ConnState, err error, attempt int) {
+	d.subsMu.Lock()
+	defer d.subsMu.Unlock()
+
+	from := d.state
+	if from == to {
+		return
+	}
+	d.state = to
+
+	if d.breaker != nil {
+		switch to {
+		case StateDown:
+			d.breaker.trip()
+		case StateRecovered, StateHealthy:
+			d.breaker.probe()
+		}
+	}
+
+	event := StateEvent{From: from, To: to, Err: err, Attempt: attempt, Time: time.Now()}
+	for _, ch := range d.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	if d.log != nil {
+		d.log.Info("🔄 Состояние соединения с БД: %s → %s", from, to)
+	}
+}
+
+// closeSubscribers закрывает каналы всех подписчиков
+func (d *DB) closeSubscribers() {
+	d.subsMu.Lock()
+	defer d.subsMu.Unlock()
+
+	for id, ch := range d.subs {
+		delete(d.subs, id)
+		close(ch)
+	}
+	d.subs = nil
+}
+
+// monitorConnection периодически проверяет соединение с БД и при устойчивом
+// отказе ждёт её восстановления
+func (d *DB) monitorConnection(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			if d.log != nil {
+				d.log.Info("🔕 Мониторинг соединения с БД остановлен")
+			}
+			return
+		case <-ticker.C:
+			d.checkReplicas(ctx)
+
+			start := time.Now()
+			err := d.HealthCheck(ctx)
+			d.recordCheck(start, err)
+			if err == nil {
+				failures = 0
+				d.setState(StateHealthy, nil, 0)
+				if d.log != nil {
+					d.log.Debug("✔️ Проверка здоровья БД успешна")
+				}
+				continue
+			}
+			if ctx.Err() != nil {
+				continue
+			}
+
+			failures++
+			if d.log != nil {
+				d.log.Warn("⚠️ Ошибка проверки здоровья БД (%d подряд): %v", failures, err)
+			}
+
+			threshold := d.opts.reconnect.FailureThreshold
+			if threshold <= 0 || failures < threshold {
+				d.setState(StateDegraded, err, 0)
+				continue
+			}
+
+			d.setState(StateDown, err, 0)
+			if d.reconnect(ctx) {
+				failures = 0
+			}
+			ticker.Reset(interval)
+		}
+	}
+}
+
+// swapConnector открывает соединения пула через текущее подключение DB.
+// reconnect заменяет подключение под DB.mu, а *sql.DB, выданный через Init,
+// Get и SQL, остаётся прежним.
+type swapConnector struct {
+	d *DB
+}
+
+func (c swapConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.d.mu.RLock()
+	connector := c.d.connector
+	c.d.mu.RUnlock()
+	return connector.Connect(ctx)
+}
+
+func (c swapConnector) Driver() driver.Driver {
+	return pq.Driver{}
+}
+
+// reconnect пересоздаёт подключение к БД с экспоненциальной задержкой до
+// успеха или отмены ctx. Новое подключение проверяется отдельным пулом и
+// только после этого заменяет прежнее; простаивающие соединения, открытые до
+// отказа, выбрасываются из пула.
+func (d *DB) reconnect(ctx context.Context) bool {
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(d.opts.reconnect.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		connector, err := d.dial(ctx)
+		if err != nil {
+			if d.log != nil {
+				d.log.Warn("⚠️ Попытка переподключения к БД #%d не удалась: %v", attempt, err)
+			}
+			continue
+		}
+
+		d.mu.Lock()
+		d.connector = connector
+		d.mu.Unlock()
+
+		// Простаивающие соединения могли быть разорваны сервером во время
+		// отказа: временное обнуление лимита закрывает их все
+		d.pool.SetMaxIdleConns(0)
+		d.pool.SetMaxIdleConns(d.cfg.DBMaxIdleConns)
+
+		d.setState(StateRecovered, nil, attempt)
+		if d.log != nil {
+			d.log.Info("✅ Соединение с базой данных восстановлено (попытка #%d)", attempt)
+		}
+		return true
+	}
+}
+
+// dial создаёт новое подключение по конфигурации и проверяет его
+func (d *DB) dial(ctx context.Context) (driver.Connector, error) {
+	connector, err := pq.NewConnector(d.cfg.DBUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	probe := sql.OpenDB(connector)
+	defer probe.Close()
+
+	pingCtx, cancel := context.WithTimeout(ctx, d.opts.pingTimeout)
+	defer cancel()
+	if err := probe.PingContext(pingCtx); err != nil {
+		return nil, err
+	}
+	return connector, nil
+}
+
+// Subscribe подписывает на смену состояния соединения по умолчанию
+func Subscribe(buffer int) (<-chan StateEvent, func(), error) {
+	d, err := Default()
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, cancel := d.Subscribe(buffer)
+	return ch, cancel, nil
+}
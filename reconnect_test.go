@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	p := ReconnectPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	jittered := p
+	jittered.Jitter = 0.2
+
+	tests := []struct {
+		name     string
+		policy   ReconnectPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first attempt", p, 1, 100 * time.Millisecond, 100 * time.Millisecond},
+		{"grows", p, 2, 200 * time.Millisecond, 200 * time.Millisecond},
+		{"grows again", p, 4, 800 * time.Millisecond, 800 * time.Millisecond},
+		{"capped", p, 5, time.Second, time.Second},
+		{"capped far out", p, 1000, time.Second, time.Second},
+		{"jitter", jittered, 2, 160 * time.Millisecond, 240 * time.Millisecond},
+		{"jitter at cap", jittered, 10, 800 * time.Millisecond, 1200 * time.Millisecond},
+		{"no delay", ReconnectPolicy{Multiplier: 2, Jitter: 0.5}, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				if got := tt.policy.backoff(tt.attempt); got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d) = %s, ожидалось в [%s, %s]", tt.attempt, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+// fakeConnector выдаёт соединения, помеченные своим именем
+type fakeConnector struct {
+	name string
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn{name: c.name}, nil
+}
+func (c fakeConnector) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	name string
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("не поддерживается")
+}
+func (c fakeConn) Close() error { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("не поддерживается")
+}
+
+func TestSwapConnectorKeepsPool(t *testing.T) {
+	d := &DB{connector: fakeConnector{name: "old"}}
+	pool := sql.OpenDB(swapConnector{d: d})
+	defer pool.Close()
+
+	connName := func() string {
+		conn, err := pool.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("Conn: %v", err)
+		}
+		defer conn.Close()
+		var name string
+		_ = conn.Raw(func(c any) error { name = c.(fakeConn).name; return nil })
+		return name
+	}
+
+	if got := connName(); got != "old" {
+		t.Fatalf("соединение от %q, ожидалось old", got)
+	}
+
+	d.mu.Lock()
+	d.connector = fakeConnector{name: "new"}
+	d.mu.Unlock()
+	pool.SetMaxIdleConns(0)
+	pool.SetMaxIdleConns(2)
+
+	if got := connName(); got != "new" {
+		t.Fatalf("после замены подключения соединение от %q, ожидалось new", got)
+	}
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WithReplicas задаёт DSN реплик, на которые направляются читающие запросы репозиториев
+func WithReplicas(dsns ...string) Option {
+	return func(o *options) { o.replicaDSNs = append(o.replicaDSNs, dsns...) }
+}
+
+// WithMaxReplicationLag задаёт допустимое отставание реплики; реплики с
+// большим отставанием исключаются из маршрутизации. 0 отключает проверку.
+func WithMaxReplicationLag(d time.Duration) Option {
+	return func(o *options) { o.maxReplicaLag = d }
+}
+
+// ReplicaStatus описывает состояние реплики на момент последней проверки
+type ReplicaStatus struct {
+	Addr      string        `json:"addr"`
+	Healthy   bool          `json:"healthy"`
+	Lag       time.Duration `json:"lag"`
+	Error     string        `json:"error,omitempty"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+type replica struct {
+	addr string
+	pool *sql.DB
+
+	mu     sync.RWMutex
+	status ReplicaStatus
+}
+
+func (r *replica) healthy() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status.Healthy
+}
+
+func (r *replica) snapshot() ReplicaStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// replicaAddr возвращает адрес реплики без учётных данных для логов и отчётов
+func replicaAddr(dsn string, i int) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return fmt.Sprintf("replica-%d", i)
+}
+
+// openReplicas открывает пулы реплик. Недоступная реплика не мешает старту:
+// она остаётся исключённой из маршрутизации до успешной проверки.
+func (d *DB) openReplicas(ctx context.Context) error {
+	for i, dsn := range d.opts.replicaDSNs {
+		conn, err := sql.Open("postgres", dsn)
+		if err != nil {
+			d.closeReplicas()
+			return fmt.Errorf("не удалось открыть соединение с репликой %s: %w", replicaAddr(dsn, i), err)
+		}
+
+		conn.SetMaxOpenConns(d.cfg.DBMaxOpenConns)
+		conn.SetMaxIdleConns(d.cfg.DBMaxIdleConns)
+		conn.SetConnMaxLifetime(d.cfg.DBConnMaxLifetime)
+		conn.SetConnMaxIdleTime(d.cfg.DBConnMaxIdleTime)
+
+		d.replicas = append(d.replicas, &replica{addr: replicaAddr(dsn, i), pool: conn})
+	}
+
+	d.checkReplicas(ctx)
+	return nil
+}
+
+// checkReplicas обновляет доступность и отставание всех реплик
+func (d *DB) checkReplicas(ctx context.Context) {
+	if len(d.replicas) == 0 {
+		return
+	}
+	primaryLSN := d.primaryWALPosition(ctx)
+
+	for _, r := range d.replicas {
+		sample, err := d.sampleReplica(ctx, r.pool, primaryLSN)
+		var lag time.Duration
+		if err == nil {
+			lag, err = sample.lag()
+		}
+		status := replicaHealth(r.addr, lag, err, d.opts.maxReplicaLag)
+
+		r.mu.Lock()
+		wasHealthy := r.status.Healthy
+		r.status = status
+		r.mu.Unlock()
+
+		if d.log == nil || wasHealthy == status.Healthy {
+			continue
+		}
+		if status.Healthy {
+			d.log.Info("✅ Реплика %s включена в маршрутизацию (отставание %s)", r.addr, lag)
+		} else {
+			d.log.Warn("⚠️ Реплика %s исключена из маршрутизации: %s", r.addr, status.Error)
+		}
+	}
+}
+
+// replicaHealth решает, допускается ли реплика к маршрутизации
+func replicaHealth(addr string, lag time.Duration, err error, maxLag time.Duration) ReplicaStatus {
+	status := ReplicaStatus{Addr: addr, Lag: lag, CheckedAt: time.Now()}
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+	case maxLag > 0 && lag > maxLag:
+		status.Error = fmt.Sprintf("отставание %s превышает допустимое %s", lag, maxLag)
+	default:
+		status.Healthy = true
+	}
+	return status
+}
+
+// primaryWALPosition возвращает текущую позицию WAL основного сервера или
+// NULL, если её не удалось получить
+func (d *DB) primaryWALPosition(ctx context.Context) sql.NullString {
+	checkCtx, cancel := context.WithTimeout(ctx, d.opts.healthTimeout)
+	defer cancel()
+
+	var lsn sql.NullString
+	if err := d.SQL().QueryRowContext(checkCtx, `SELECT pg_current_wal_lsn()::text`).Scan(&lsn); err != nil {
+		if d.log != nil {
+			d.log.Debug("Не удалось получить позицию WAL основного сервера: %v", err)
+		}
+		return sql.NullString{}
+	}
+	return lsn
+}
+
+// replicaSample — состояние реплики относительно основного сервера
+type replicaSample struct {
+	inRecovery bool            // сервер действительно реплика
+	caughtUp   bool            // применён весь WAL, записанный основным сервером к началу проверки
+	replayAge  sql.NullFloat64 // секунд с момента фиксации последней применённой транзакции
+}
+
+// lag возвращает отставание реплики. Нулевым оно считается, только если
+// реплика применила WAL до позиции, которую основной сервер сообщил перед
+// проверкой: совпадение полученного и применённого WAL самой реплики ничего
+// не говорит об отставании, если она потеряла связь с основным сервером.
+func (s replicaSample) lag() (time.Duration, error) {
+	switch {
+	case !s.inRecovery, s.caughtUp:
+		return 0, nil
+	case !s.replayAge.Valid:
+		return 0, errors.New("реплика ещё не применила ни одной транзакции")
+	default:
+		return time.Duration(s.replayAge.Float64 * float64(time.Second)), nil
+	}
+}
+
+// sampleReplica сравнивает позицию применённого репликой WAL с позицией
+// основного сервера primaryLSN. Без primaryLSN отставание оценивается по
+// времени последней применённой транзакции.
+func (d *DB) sampleReplica(ctx context.Context, pool *sql.DB, primaryLSN sql.NullString) (replicaSample, error) {
+	checkCtx, cancel := context.WithTimeout(ctx, d.opts.healthTimeout)
+	defer cancel()
+
+	var s replicaSample
+	err := pool.QueryRowContext(checkCtx,
+		`SELECT pg_is_in_recovery(),
+		        COALESCE(pg_last_wal_replay_lsn() >= $1::pg_lsn, FALSE),
+		        EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())`,
+		primaryLSN,
+	).Scan(&s.inRecovery, &s.caughtUp, &s.replayAge)
+	if err != nil {
+		return replicaSample{}, fmt.Errorf("%w: %v", ErrDBConnectionLost, err)
+	}
+	return s, nil
+}
+
+// closeReplicas закрывает пулы всех реплик
+func (d *DB) closeReplicas() {
+	for _, r := range d.replicas {
+		_ = r.pool.Close()
+	}
+}
+
+// Reader возвращает пул для читающих запросов: одну из доступных реплик по
+// кругу или основной пул, если доступных реплик нет
+func (d *DB) Reader() *sql.DB {
+	n := len(d.replicas)
+	if n > 0 {
+		start := d.rr.Add(1)
+		for i := 0; i < n; i++ {
+			r := d.replicas[(start+uint64(i))%uint64(n)]
+			if r.healthy() {
+				return r.pool
+			}
+		}
+	}
+	return d.SQL()
+}
+
+// Replicas возвращает состояние реплик на момент последней проверки
+func (d *DB) Replicas() []ReplicaStatus {
+	list := make([]ReplicaStatus, 0, len(d.replicas))
+	for _, r := range d.replicas {
+		list = append(list, r.snapshot())
+	}
+	return list
+}
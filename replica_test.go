@@ -0,0 +1,48 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReplicaHealth(t *testing.T) {
+	age := func(seconds float64) sql.NullFloat64 { return sql.NullFloat64{Float64: seconds, Valid: true} }
+	const maxLag = 10 * time.Second
+
+	tests := []struct {
+		name    string
+		sample  replicaSample
+		maxLag  time.Duration
+		lag     time.Duration
+		healthy bool
+	}{
+		{"caught up with primary", replicaSample{inRecovery: true, caughtUp: true, replayAge: age(3600)}, maxLag, 0, true},
+		{"behind within threshold", replicaSample{inRecovery: true, replayAge: age(2)}, maxLag, 2 * time.Second, true},
+		{"behind over threshold", replicaSample{inRecovery: true, replayAge: age(30)}, maxLag, 30 * time.Second, false},
+		{"disconnected and stale", replicaSample{inRecovery: true, replayAge: age(600)}, maxLag, 10 * time.Minute, false},
+		{"threshold disabled", replicaSample{inRecovery: true, replayAge: age(600)}, 0, 10 * time.Minute, true},
+		{"nothing replayed", replicaSample{inRecovery: true}, maxLag, 0, false},
+		{"not in recovery", replicaSample{}, maxLag, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lag, err := tt.sample.lag()
+			if lag != tt.lag {
+				t.Errorf("отставание %s, ожидалось %s", lag, tt.lag)
+			}
+			status := replicaHealth("replica", lag, err, tt.maxLag)
+			if status.Healthy != tt.healthy || (status.Error == "") != tt.healthy {
+				t.Errorf("состояние %+v, ожидалась доступность %v", status, tt.healthy)
+			}
+		})
+	}
+}
+
+func TestReplicaHealthCheckError(t *testing.T) {
+	status := replicaHealth("replica", 0, errors.New("соединение отклонено"), time.Second)
+	if status.Healthy || status.Error == "" {
+		t.Fatalf("реплика с ошибкой проверки считается доступной: %+v", status)
+	}
+}
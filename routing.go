@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Executor — общий набор методов *sql.DB, *sql.Tx и *sql.Conn, через который
+// репозитории выполняют запросы
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var (
+	_ Executor = (*sql.DB)(nil)
+	_ Executor = (*sql.Tx)(nil)
+	_ Executor = (*sql.Conn)(nil)
+)
+
+// connProvider выдаёт репозиториям исполнителей для записи и для чтения
+type connProvider interface {
+	primary() Executor
+	reader() Executor
+	// contextTx возвращает транзакцию из ctx, к которой репозиторий должен
+	// присоединиться
+	contextTx(ctx context.Context) (*sql.Tx, bool)
+}
+
+// singleConn направляет все запросы в один исполнитель (пул или транзакцию)
+type singleConn struct {
+	exec Executor
+}
+
+func (c singleConn) primary() Executor { return c.exec }
+func (c singleConn) reader() Executor  { return c.exec }
+
+// contextTx присоединяет репозиторий, созданный над пулом, к транзакции
+// RunInTransaction того же пула. Репозиторий, привязанный через WithTx к
+// транзакции или соединению, всегда работает в нём.
+func (c singleConn) contextTx(ctx context.Context) (*sql.Tx, bool) {
+	pool, ok := c.exec.(*sql.DB)
+	if !ok {
+		return nil, false
+	}
+	st, ok := ctx.Value(txContextKey{}).(*txState)
+	if !ok || st.db == nil || st.db.SQL() != pool {
+		return nil, false
+	}
+	return st.tx, true
+}
+
+func (d *DB) primary() Executor { return d.SQL() }
+func (d *DB) reader() Executor  { return d.Reader() }
+
+// contextTx возвращает транзакцию из ctx, только если она открыта этим же DB
+func (d *DB) contextTx(ctx context.Context) (*sql.Tx, bool) {
+	return txOwnedBy(ctx, d)
+}
+
+// txOwnedBy возвращает транзакцию RunInTransaction из ctx, если её открыл d
+func txOwnedBy(ctx context.Context, d *DB) (*sql.Tx, bool) {
+	st, ok := ctx.Value(txContextKey{}).(*txState)
+	if !ok || st.db != d {
+		return nil, false
+	}
+	return st.tx, true
+}
+
+// writerFor возвращает исполнителя для записи: транзакцию из ctx, если
+// репозиторий к ней присоединяется
+func writerFor(ctx context.Context, c connProvider) Executor {
+	if tx, ok := c.contextTx(ctx); ok {
+		return tx
+	}
+	return c.primary()
+}
+
+// readerFor возвращает исполнителя для чтения. Внутри транзакции чтение идёт
+// через неё, чтобы видеть собственные незафиксированные изменения.
+func readerFor(ctx context.Context, c connProvider) Executor {
+	if tx, ok := c.contextTx(ctx); ok {
+		return tx
+	}
+	return c.reader()
+}
+
+// Users возвращает репозиторий пользователей, читающие методы которого
+// направляются на реплики, а запись — на основной пул
+func (d *DB) Users() UserRepository {
+	return &userRepo{conns: d, ins: d.instrumentation("users"), norm: d.opts.normalizer, tokens: d.opts.confirmTokens}
+}
+
+// UserLogins возвращает репозиторий истории входов с маршрутизацией чтения на реплики
+func (d *DB) UserLogins() *UserLoginRepositoryImpl {
+	return &UserLoginRepositoryImpl{conns: d, ins: d.instrumentation("user_logins"), norm: d.opts.normalizer}
+}
+
+func (d *DB) instrumentation(repo string) instrumentation {
+	return instrumentation{repo: repo, db: d, metrics: d.opts.metrics, hooks: d.opts.hooks, inflight: d.inflight, breaker: d.breaker}
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestRoutingContextTransaction(t *testing.T) {
+	d, other := newTestDB(), newTestDB()
+	defer d.pool.Close()
+	defer other.pool.Close()
+
+	ownTx, otherTx, boundTx := &sql.Tx{}, &sql.Tx{}, &sql.Tx{}
+	withTx := func(owner *DB, tx *sql.Tx) context.Context {
+		return context.WithValue(context.Background(), txContextKey{}, &txState{db: owner, tx: tx})
+	}
+
+	tests := []struct {
+		name  string
+		conns connProvider
+		ctx   context.Context
+		want  Executor
+	}{
+		{"DB without transaction", d, context.Background(), d.pool},
+		{"DB joins own transaction", d, withTx(d, ownTx), ownTx},
+		{"DB ignores other DB transaction", d, withTx(other, otherTx), d.pool},
+		{"pool joins transaction of the same pool", singleConn{exec: d.pool}, withTx(d, ownTx), ownTx},
+		{"pool ignores transaction of other pool", singleConn{exec: d.pool}, withTx(other, otherTx), d.pool},
+		{"WithTx wins over context transaction", singleConn{exec: boundTx}, withTx(d, ownTx), boundTx},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writerFor(tt.ctx, tt.conns); got != tt.want {
+				t.Errorf("writerFor = %p, ожидался %p", got, tt.want)
+			}
+			if got := readerFor(tt.ctx, tt.conns); got != tt.want {
+				t.Errorf("readerFor = %p, ожидался %p", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InFlightOp описывает операцию, выполнявшуюся в момент остановки
+type InFlightOp struct {
+	Kind    string        `json:"kind"` // query или transaction
+	Name    string        `json:"name"`
+	Started time.Time     `json:"started"`
+	Running time.Duration `json:"running"`
+}
+
+// ShutdownError возвращается Shutdown, если к дедлайну остались незавершённые операции
+type ShutdownError struct {
+	Pending []InFlightOp
+	Err     error
+}
+
+// Error перечисляет незавершённые операции
+func (e *ShutdownError) Error() string {
+	names := make([]string, len(e.Pending))
+	for i, op := range e.Pending {
+		names[i] = fmt.Sprintf("%s %s (%s)", op.Kind, op.Name, op.Running.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("остановка БД не дождалась %d операций: %s: %v", len(e.Pending), strings.Join(names, ", "), e.Err)
+}
+
+// Unwrap возвращает причину прерывания ожидания (обычно context.DeadlineExceeded)
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// inflightTracker учитывает выполняющиеся запросы и транзакции
+type inflightTracker struct {
+	mu       sync.Mutex
+	nextID   uint64
+	ops      map[uint64]InFlightOp
+	draining bool
+	drained  chan struct{}
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{ops: map[uint64]InFlightOp{}, drained: make(chan struct{})}
+}
+
+// begin регистрирует операцию. После начала остановки принимаются только
+// операции внутри уже начатой транзакции (inTx), остальные отклоняются с
+// ErrShuttingDown: иначе под постоянной нагрузкой ожидание не закончится до
+// дедлайна.
+func (t *inflightTracker) begin(kind, name string, inTx bool) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining && !inTx {
+		return 0, ErrShuttingDown
+	}
+
+	t.nextID++
+	t.ops[t.nextID] = InFlightOp{Kind: kind, Name: name, Started: time.Now()}
+	return t.nextID, nil
+}
+
+// end снимает операцию с учёта
+func (t *inflightTracker) end(id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.ops, id)
+	if t.draining && len(t.ops) == 0 {
+		t.closeDrained()
+	}
+}
+
+// startDraining запрещает новые операции вне транзакций и возвращает канал,
+// закрываемый при завершении последней операции
+func (t *inflightTracker) startDraining() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.draining = true
+	if len(t.ops) == 0 {
+		t.closeDrained()
+	}
+	return t.drained
+}
+
+// isDraining сообщает, что остановка началась
+func (t *inflightTracker) isDraining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.draining
+}
+
+func (t *inflightTracker) closeDrained() {
+	select {
+	case <-t.drained:
+	default:
+		close(t.drained)
+	}
+}
+
+// pending возвращает незавершённые операции, начиная с самых долгих
+func (t *inflightTracker) pending() []InFlightOp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	list := make([]InFlightOp, 0, len(t.ops))
+	for _, op := range t.ops {
+		op.Running = now.Sub(op.Started)
+		list = append(list, op)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// Shutdown корректно останавливает экземпляр: отклоняет новые транзакции и
+// запросы вне начатых транзакций, переводит ReadinessHandler в 503, ждёт завершения начатых запросов и транзакций до дедлайна ctx, затем
+// останавливает мониторинг и закрывает пулы. Если дедлайн наступил раньше,
+// возвращается *ShutdownError со списком незавершённых операций, а пул
+// закрывается в фоне после их завершения.
+func (d *DB) Shutdown(ctx context.Context) error {
+	drained := d.inflight.startDraining()
+
+	if d.log != nil {
+		d.log.Info("⏳ Остановка БД: ожидание %d незавершённых операций", len(d.inflight.pending()))
+	}
+
+	select {
+	case <-drained:
+		return d.Close()
+	case <-ctx.Done():
+	}
+
+	pending := d.inflight.pending()
+	if d.log != nil {
+		d.log.Warn("⚠️ Остановка БД прервана по дедлайну, не завершено операций: %d", len(pending))
+	}
+
+	// Мониторинг останавливается сразу, а закрытие пула ждёт начатые запросы
+	if d.stopMonitor != nil {
+		d.stopMonitor()
+		<-d.monitorDone
+	}
+	go func() { _ = d.Close() }()
+
+	return &ShutdownError{Pending: pending, Err: ctx.Err()}
+}
+
+// Shutdown корректно останавливает соединение по умолчанию. Экземпляр
+// отвязывается от пакета сразу, а ожидание идёт без глобальной блокировки:
+// иначе транзакции, вызывающие функции пакета, не смогли бы завершиться.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	d := defaultDB
+	defaultDB = nil
+	mu.Unlock()
+
+	if d == nil {
+		return nil
+	}
+	return d.Shutdown(ctx)
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInflightTrackerDraining(t *testing.T) {
+	tr := newInflightTracker()
+	query, _ := tr.begin("query", "users.GetUserByID", false)
+	tx, _ := tr.begin("transaction", "transfer", false)
+
+	drained := tr.startDraining()
+
+	tests := []struct {
+		name string
+		kind string
+		inTx bool
+		want error
+	}{
+		{"new transaction", "transaction", false, ErrShuttingDown},
+		{"query outside transaction", "query", false, ErrShuttingDown},
+		{"query inside transaction", "query", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tr.begin(tt.kind, tt.name, tt.inTx)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("begin: %v, ожидалось %v", err, tt.want)
+			}
+			if err == nil {
+				tr.end(id)
+			}
+		})
+	}
+
+	tr.end(query)
+	select {
+	case <-drained:
+		t.Fatal("остановка завершилась при незавершённой транзакции")
+	default:
+	}
+	if pending := tr.pending(); len(pending) != 1 || pending[0].Name != "transfer" {
+		t.Fatalf("незавершённые операции %+v, ожидалась транзакция transfer", pending)
+	}
+
+	tr.end(tx)
+	select {
+	case <-drained:
+	default:
+		t.Fatal("остановка не завершилась после последней операции")
+	}
+}
+
+// newTestDB возвращает DB без подключения к PostgreSQL
+func newTestDB() *DB {
+	return &DB{pool: sql.OpenDB(fakeConnector{name: "test"}), inflight: newInflightTracker()}
+}
+
+func TestShutdownWaitsForOperations(t *testing.T) {
+	d := newTestDB()
+	id, _ := d.inflight.begin("transaction", "transfer", false)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		d.inflight.end(id)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if !d.closed.Load() {
+		t.Fatal("экземпляр не закрыт после Shutdown")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	d := newTestDB()
+	first, _ := d.inflight.begin("transaction", "transfer", false)
+	time.Sleep(time.Millisecond)
+	second, _ := d.inflight.begin("query", "users.UpdateUser", false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := d.Shutdown(ctx)
+
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown: %v, ожидалась ShutdownError с DeadlineExceeded", err)
+	}
+	pending := shutdownErr.Pending
+	if len(pending) != 2 || pending[0].Name != "transfer" || pending[1].Name != "users.UpdateUser" ||
+		pending[0].Kind != "transaction" || pending[0].Running <= 0 {
+		t.Fatalf("незавершённые операции %+v", pending)
+	}
+
+	// Пул закрывается в фоне после завершения оставшихся операций
+	d.inflight.end(first)
+	d.inflight.end(second)
+}
+
+func TestReadinessWhileDraining(t *testing.T) {
+	d := newTestDB()
+	d.inflight.begin("transaction", "transfer", false)
+	d.inflight.startDraining()
+
+	rec := httptest.NewRecorder()
+	d.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness при остановке: %d, ожидался 503", rec.Code)
+	}
+}
+
+func TestQueriesRejectedWhileDraining(t *testing.T) {
+	tr := newInflightTracker()
+	tr.startDraining()
+	d := &DB{inflight: tr}
+	in := instrumentation{repo: "users", db: d, inflight: tr}
+
+	_, q, err := in.start(context.Background(), "GetUserByID", "SELECT 1")
+	q.finish(&err)
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("запрос вне транзакции при остановке: %v, ожидалась ErrShuttingDown", err)
+	}
+
+	txCtx := context.WithValue(context.Background(), txContextKey{}, &txState{db: d})
+	_, q, err = in.start(txCtx, "GetUserByID", "SELECT 1")
+	q.finish(&err)
+	if err != nil {
+		t.Fatalf("запрос внутри транзакции при остановке: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/skrolikov/vira-logger"
+)
+
+// SlowQueryConfig задаёт журналирование медленных запросов репозиториев
+type SlowQueryConfig struct {
+	Threshold         time.Duration        // запросы дольше порога попадают в журнал
+	ExplainSampleRate float64              // доля медленных запросов, для которых снимается EXPLAIN, от 0 до 1
+	ExplainTimeout    time.Duration        // таймаут EXPLAIN (по умолчанию 5s)
+	MaxExplains       int                  // одновременно выполняемых EXPLAIN (по умолчанию 2); лишние выборки пропускаются
+	Explain           Executor             // где выполнять EXPLAIN; nil отключает планы
+	Logger            *logger.Logger       // по умолчанию — логгер пакета
+	RedactArg         func(arg any) string // представление параметра в журнале; по умолчанию redactArg
+}
+
+// WithSlowQueryLog включает журналирование медленных запросов для репозиториев
+// экземпляра. Если cfg.Explain не задан, EXPLAIN выполняется на основном пуле.
+func WithSlowQueryLog(cfg SlowQueryConfig) Option {
+	return func(o *options) { o.slowQuery = &cfg }
+}
+
+// slowQueryHook журналирует запросы, превысившие порог
+type slowQueryHook struct {
+	cfg      SlowQueryConfig
+	explains chan struct{} // занятые места для EXPLAIN
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+// NewSlowQueryHook возвращает хук журналирования медленных запросов
+func NewSlowQueryHook(cfg SlowQueryConfig) QueryHook {
+	return newSlowQueryHook(cfg)
+}
+
+func newSlowQueryHook(cfg SlowQueryConfig) *slowQueryHook {
+	if cfg.ExplainTimeout <= 0 {
+		cfg.ExplainTimeout = 5 * time.Second
+	}
+	if cfg.MaxExplains <= 0 {
+		cfg.MaxExplains = 2
+	}
+	if cfg.RedactArg == nil {
+		cfg.RedactArg = redactArg
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &slowQueryHook{cfg: cfg, explains: make(chan struct{}, cfg.MaxExplains), ctx: ctx, cancel: cancel}
+}
+
+// close прерывает выполняющиеся EXPLAIN, дожидается их и запрещает новые
+func (h *slowQueryHook) close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+
+	h.cancel()
+	h.running.Wait()
+}
+
+// acquireExplain занимает место для EXPLAIN; false, если мест нет или хук закрыт
+func (h *slowQueryHook) acquireExplain() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	select {
+	case h.explains <- struct{}{}:
+		h.running.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *slowQueryHook) releaseExplain() {
+	<-h.explains
+	h.running.Done()
+}
+
+func (h *slowQueryHook) BeforeQuery(ctx context.Context, _ QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery журналирует медленный запрос без параметров. Репозитории пакета
+// вызывают afterQueryArgs.
+func (h *slowQueryHook) AfterQuery(ctx context.Context, event QueryEvent) {
+	h.afterQueryArgs(ctx, event, nil)
+}
+
+// afterQueryArgs журналирует медленный запрос с параметрами, скрытыми через
+// RedactArg; сами значения используются только для EXPLAIN
+func (h *slowQueryHook) afterQueryArgs(_ context.Context, event QueryEvent, queryArgs []any) {
+	if h.cfg.Threshold <= 0 || event.Duration < h.cfg.Threshold {
+		return
+	}
+
+	log := h.cfg.Logger
+	if log == nil {
+		log = logg
+	}
+	if log == nil {
+		return
+	}
+
+	args := make([]string, len(queryArgs))
+	for i, arg := range queryArgs {
+		args[i] = fmt.Sprintf("$%d=%s", i+1, h.cfg.RedactArg(arg))
+	}
+	entry := fmt.Sprintf("🐢 Медленный запрос %s.%s: %s (порог %s), параметры: [%s]",
+		event.Repository, event.Operation, event.Duration, h.cfg.Threshold, strings.Join(args, " "))
+
+	// Без значений параметров (вызов через AfterQuery) EXPLAIN не выполнить
+	if h.cfg.Explain == nil || len(queryArgs) != event.ArgCount ||
+		h.cfg.ExplainSampleRate <= 0 || rand.Float64() >= h.cfg.ExplainSampleRate {
+		log.Warn("%s", entry)
+		return
+	}
+
+	// Когда база и так медленная, EXPLAIN не должны добавлять ей нагрузки:
+	// выборки сверх MaxExplains журналируются без плана
+	if !h.acquireExplain() {
+		log.Warn("%s, EXPLAIN пропущен", entry)
+		return
+	}
+
+	// EXPLAIN выполняется в фоне, чтобы не задерживать вызывающий код
+	go func() {
+		defer h.releaseExplain()
+		ctx, cancel := context.WithTimeout(h.ctx, h.cfg.ExplainTimeout)
+		defer cancel()
+
+		plan, err := explainQuery(ctx, h.cfg.Explain, event.SQL, queryArgs)
+		if err != nil {
+			log.Warn("%s, EXPLAIN не выполнен: %v", entry, err)
+			return
+		}
+		log.Warn("%s, план: %s", entry, plan)
+	}()
+}
+
+// explainQuery возвращает план запроса в формате JSON. Используется EXPLAIN
+// без ANALYZE, поэтому изменяющие запросы не выполняются повторно.
+func explainQuery(ctx context.Context, exec Executor, query string, args []any) (string, error) {
+	var plan string
+	if err := exec.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&plan); err != nil {
+		return "", ClassifyError(err)
+	}
+	return plan, nil
+}
+
+// redactArg скрывает значения строковых и бинарных параметров, оставляя их
+// тип и длину; числа, флаги и время выводятся как есть
+func redactArg(arg any) string {
+	if v, ok := arg.(driver.Valuer); ok {
+		val, err := v.Value()
+		if err != nil {
+			return "<error>"
+		}
+		arg = val
+	}
+
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("<string:%d>", len(v))
+	case []byte:
+		return fmt.Sprintf("<bytes:%d>", len(v))
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	default:
+		return fmt.Sprintf("<%T>", v)
+	}
+}
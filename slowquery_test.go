@@ -0,0 +1,44 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowQueryHookLimitsExplains(t *testing.T) {
+	h := newSlowQueryHook(SlowQueryConfig{MaxExplains: 2})
+
+	if !h.acquireExplain() || !h.acquireExplain() {
+		t.Fatal("места для EXPLAIN в пределах MaxExplains не выданы")
+	}
+	if h.acquireExplain() {
+		t.Fatal("выдано место сверх MaxExplains")
+	}
+
+	h.releaseExplain()
+	if !h.acquireExplain() {
+		t.Fatal("освобождённое место не выдано повторно")
+	}
+
+	// close ждёт выполняющиеся EXPLAIN и отменяет их контекст
+	done := make(chan struct{})
+	go func() {
+		h.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("close не дождался выполняющихся EXPLAIN")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if h.ctx.Err() == nil {
+		t.Error("контекст EXPLAIN не отменён при close")
+	}
+
+	h.releaseExplain()
+	h.releaseExplain()
+	<-done
+	if h.acquireExplain() {
+		t.Fatal("после close выдано место для EXPLAIN")
+	}
+}
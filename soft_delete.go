@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type includeDeletedKey struct{}
+
+// WithDeletedUsers возвращает контекст, в котором методы чтения репозитория
+// пользователей (GetUserBy*, ExistsBy*, списки и поиск) возвращают и мягко
+// удалённых пользователей. По умолчанию удалённые пользователи скрыты.
+func WithDeletedUsers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+// DeletedUsersIncluded сообщает, запрошено ли через WithDeletedUsers чтение удалённых пользователей
+func DeletedUsersIncluded(ctx context.Context) bool {
+	included, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return included
+}
+
+type skipVersionCheckKey struct{}
+
+// WithoutVersionCheck возвращает контекст, в котором UpdateUserContext и
+// UpdateUserReturning перезаписывают пользователя без сравнения
+// User.Version: одновременные изменения при этом теряются.
+func WithoutVersionCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipVersionCheckKey{}, true)
+}
+
+// VersionCheckSkipped сообщает, запрошено ли через WithoutVersionCheck обновление без проверки версии
+func VersionCheckSkipped(ctx context.Context) bool {
+	skipped, _ := ctx.Value(skipVersionCheckKey{}).(bool)
+	return skipped
+}
+
+// notDeleted возвращает условие, скрывающее удалённых пользователей, если
+// ctx не разрешает их чтение
+func notDeleted(ctx context.Context) string {
+	if DeletedUsersIncluded(ctx) {
+		return ""
+	}
+	return " AND deleted_at IS NULL"
+}
+
+// RestoreUser восстанавливает мягко удалённого пользователя. Если его
+// username или email за это время занял другой пользователь, возвращается
+// ErrDuplicateUsername или ErrDuplicateEmail; если удалённого пользователя с
+// таким ID нет — ErrUserNotFound.
+func (r *userRepo) RestoreUser(ctx context.Context, id string) error {
+	_, err := r.RestoreUserReturning(ctx, id)
+	return err
+}
+
+// RestoreUserReturning восстанавливает пользователя и возвращает восстановленную запись
+func (r *userRepo) RestoreUserReturning(ctx context.Context, id string) (_ *User, err error) {
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING ` + userColumns
+
+	ctx, q, err := r.ins.start(ctx, "RestoreUser", query, id)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		err = ClassifyError(err)
+		if isDuplicateUserError(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+	q.rows = 1
+	return user, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удалённых
+// раньше before, и возвращает их число
+func (r *userRepo) PurgeDeletedUsers(ctx context.Context, before time.Time) (_ int64, err error) {
+	query := `DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1`
+
+	ctx, q, err := r.ins.start(ctx, "PurgeDeletedUsers", query, before)
+	defer q.finish(&err)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := writerFor(ctx, r.conns).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted users: %w", ClassifyError(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", ClassifyError(err))
+	}
+
+	q.rows = rowsAffected
+	return rowsAffected, nil
+}
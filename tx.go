@@ -0,0 +1,278 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// TxOption настраивает транзакцию, открываемую через WithTransaction
+type TxOption func(*txOptions)
+
+type txOptions struct {
+	isolation  sql.IsolationLevel
+	readOnly   bool
+	deferrable bool
+	retry      *RetryPolicy
+	name       string
+}
+
+// WithIsolation задаёт уровень изоляции транзакции
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *txOptions) { o.isolation = level }
+}
+
+// ReadOnly открывает транзакцию только для чтения
+func ReadOnly() TxOption {
+	return func(o *txOptions) { o.readOnly = true }
+}
+
+// Deferrable открывает транзакцию как DEFERRABLE. Postgres учитывает этот
+// режим только для SERIALIZABLE READ ONLY транзакций, поэтому опция
+// включает оба режима.
+func Deferrable() TxOption {
+	return func(o *txOptions) {
+		o.deferrable = true
+		o.readOnly = true
+		o.isolation = sql.LevelSerializable
+	}
+}
+
+// WithRetry включает повтор транзакции по политике p
+func WithRetry(p RetryPolicy) TxOption {
+	return func(o *txOptions) { o.retry = &p }
+}
+
+// WithTxName задаёт имя транзакции, под которым она видна в отчёте Shutdown
+func WithTxName(name string) TxOption {
+	return func(o *txOptions) { o.name = name }
+}
+
+// RetryPolicy задаёт повтор транзакции при ошибках сериализации (40001) и
+// взаимоблокировках (40P01). Тело транзакции при этом выполняется повторно,
+// поэтому оно не должно иметь побочных эффектов вне БД.
+type RetryPolicy struct {
+	MaxAttempts    int           // общее число попыток, включая первую
+	InitialBackoff time.Duration // задержка перед первым повтором
+	MaxBackoff     time.Duration // верхняя граница задержки
+}
+
+// DefaultRetryPolicy возвращает политику повтора по умолчанию
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     500 * time.Millisecond,
+	}
+}
+
+// backoff возвращает задержку перед повтором после попытки attempt (начиная с 1)
+// с полным случайным разбросом
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff << (attempt - 1)
+	if delay <= 0 || delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(delay)) + 1)
+}
+
+// shouldRetry сообщает, нужно ли повторить транзакцию после попытки attempt,
+// завершившейся ошибкой err. nil-политика повторов не допускает.
+func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	return p != nil && err != nil && attempt < p.MaxAttempts && isRetryableTxError(err)
+}
+
+type txContextKey struct{}
+
+// txState — активная транзакция, переносимая в context.Context
+type txState struct {
+	db         *DB
+	tx         *sql.Tx
+	savepoints int
+}
+
+// TxFromContext возвращает транзакцию, открытую RunInTransaction, если она есть в ctx
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	st, ok := ctx.Value(txContextKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return st.tx, true
+}
+
+// withSavepoint выполняет fn внутри активной транзакции под отдельным SAVEPOINT
+func (st *txState) withSavepoint(ctx context.Context, fn func(ctx context.Context) error) error {
+	st.savepoints++
+	name := fmt.Sprintf("vira_sp_%d", st.savepoints)
+
+	if _, err := st.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("не удалось создать точку сохранения: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = st.tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT "+name)
+			panic(p) // повторно вызываем панику после отката
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		if _, rbErr := st.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return fmt.Errorf("ошибка транзакции: %w, ошибка отката к точке сохранения: %w", err, rbErr)
+		}
+		return err
+	}
+
+	if _, err := st.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("не удалось освободить точку сохранения: %w", err)
+	}
+	return nil
+}
+
+// isRetryableTxError проверяет, что транзакцию можно безопасно повторить
+func isRetryableTxError(err error) bool {
+	class := ErrorClassOf(err)
+	return class == ClassSerializationFailure || class == ClassDeadlock
+}
+
+// WithTransaction выполняет операции в транзакции. Если ctx уже несёт
+// транзакцию этого же DB (см. RunInTransaction), fn выполняется внутри неё
+// под SAVEPOINT.
+//
+// fn получает только *sql.Tx, без контекста с транзакцией, поэтому вызовы
+// WithTransaction и RunInTransaction внутри fn открывают отдельную
+// независимую транзакцию. Для вложенных вызовов используйте
+// WithTransactionContext или RunInTransaction.
+func (d *DB) WithTransaction(ctx context.Context, fn func(*sql.Tx) error, opts ...TxOption) error {
+	return d.WithTransactionContext(ctx, func(_ context.Context, tx *sql.Tx) error {
+		return fn(tx)
+	}, opts...)
+}
+
+// WithTransactionContext работает как WithTransaction, но передаёт fn и
+// контекст с транзакцией: вызовы WithTransactionContext, RunInTransaction и
+// методов репозиториев с этим контекстом выполняются в той же транзакции, а
+// вложенные транзакции — под SAVEPOINT.
+func (d *DB) WithTransactionContext(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error, opts ...TxOption) error {
+	return d.RunInTransaction(ctx, func(ctx context.Context) error {
+		tx, _ := TxFromContext(ctx)
+		return fn(ctx, tx)
+	}, opts...)
+}
+
+// RunInTransaction выполняет fn в транзакции, передавая ей контекст с этой
+// транзакцией. Вложенный вызов с таким контекстом не открывает новую
+// транзакцию, а создаёт SAVEPOINT: ошибка fn откатывает только изменения
+// вложенного вызова. Опции и повторы применяются только к внешней транзакции.
+func (d *DB) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	if st, ok := ctx.Value(txContextKey{}).(*txState); ok && st.db == d {
+		return st.withSavepoint(ctx, fn)
+	}
+
+	o := txOptions{name: "transaction"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	id, err := d.inflight.begin("transaction", o.name, false)
+	if err != nil {
+		return err
+	}
+	defer d.inflight.end(id)
+
+	if d.breaker != nil {
+		var ticket breakerTicket
+		if ticket, err = d.breaker.allow(); err != nil {
+			return err
+		}
+		defer func() { d.breaker.done(ticket, err) }()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = d.runTransaction(ctx, fn, o)
+		if !o.retry.shouldRetry(attempt, err) {
+			return err
+		}
+
+		delay := o.retry.backoff(attempt)
+		if d.log != nil {
+			d.log.Debug("🔁 Повтор транзакции (попытка %d) через %s: %v", attempt+1, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// runTransaction выполняет одну попытку транзакции
+func (d *DB) runTransaction(ctx context.Context, fn func(ctx context.Context) error, o txOptions) error {
+	tx, err := d.SQL().BeginTx(ctx, &sql.TxOptions{Isolation: o.isolation, ReadOnly: o.readOnly})
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p) // повторно вызываем панику после отката
+		}
+	}()
+
+	if o.deferrable {
+		if _, err := tx.ExecContext(ctx, `SET TRANSACTION DEFERRABLE`); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("не удалось установить режим DEFERRABLE: %w", err)
+		}
+	}
+
+	txCtx := context.WithValue(ctx, txContextKey{}, &txState{db: d, tx: tx})
+	if err := fn(txCtx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			err = fmt.Errorf("ошибка транзакции: %w, ошибка отката: %w", err, rbErr)
+			return err
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось зафиксировать транзакцию: %w", err)
+	}
+
+	return nil
+}
+
+// WithTransactionResult выполняет fn в транзакции и возвращает её результат.
+// Если d равен nil, используется соединение по умолчанию.
+func WithTransactionResult[T any](ctx context.Context, d *DB, fn func(*sql.Tx) (T, error), opts ...TxOption) (T, error) {
+	var zero T
+	if d == nil {
+		var err error
+		if d, err = Default(); err != nil {
+			return zero, err
+		}
+	}
+
+	var result T
+	err := d.WithTransaction(ctx, func(tx *sql.Tx) error {
+		v, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	}, opts...)
+	if err != nil {
+		return zero, err
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	config "github.com/skrolikov/vira-config"
+	db "github.com/skrolikov/vira-db"
+	"github.com/skrolikov/vira-db/dbtest"
+)
+
+func TestNestedTransactionSavepoints(t *testing.T) {
+	cfg := &config.Config{DBUrl: dbtest.DSN(t), DBMaxOpenConns: 2, DBMaxIdleConns: 1}
+	ctx := context.Background()
+
+	d, err := db.Open(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+
+	errInner := errors.New("откат вложенной транзакции")
+	var got []int
+
+	err = d.WithTransactionContext(ctx, func(ctx context.Context, outer *sql.Tx) error {
+		if _, err := outer.ExecContext(ctx, `CREATE TEMP TABLE savepoint_probe (v INT) ON COMMIT DROP`); err != nil {
+			return err
+		}
+		if _, err := outer.ExecContext(ctx, `INSERT INTO savepoint_probe VALUES (1)`); err != nil {
+			return err
+		}
+
+		// Ошибка во вложенной транзакции откатывает только её SAVEPOINT
+		err := d.WithTransactionContext(ctx, func(ctx context.Context, inner *sql.Tx) error {
+			if inner != outer {
+				t.Error("вложенный вызов открыл отдельную транзакцию вместо SAVEPOINT")
+			}
+			if _, err := inner.ExecContext(ctx, `INSERT INTO savepoint_probe VALUES (2)`); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("ожидалась ошибка вложенной транзакции, получено %v", err)
+		}
+
+		// Успешная вложенная транзакция сохраняется во внешней
+		err = d.RunInTransaction(ctx, func(ctx context.Context) error {
+			tx, _ := db.TxFromContext(ctx)
+			_, err := tx.ExecContext(ctx, `INSERT INTO savepoint_probe VALUES (3)`)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		rows, err := outer.QueryContext(ctx, `SELECT v FROM savepoint_probe ORDER BY v`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var v int
+			if err := rows.Scan(&v); err != nil {
+				return err
+			}
+			got = append(got, v)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		t.Fatalf("внешняя транзакция: %v", err)
+	}
+	if want := []int{1, 3}; !slices.Equal(got, want) {
+		t.Fatalf("после отката к SAVEPOINT ожидались строки %v, получено %v", want, got)
+	}
+}
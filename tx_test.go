@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		max     time.Duration
+	}{
+		{"first retry", p, 1, 10 * time.Millisecond},
+		{"doubles", p, 2, 20 * time.Millisecond},
+		{"doubles again", p, 3, 40 * time.Millisecond},
+		{"capped", p, 4, 50 * time.Millisecond},
+		{"shift overflow", p, 70, 50 * time.Millisecond},
+		{"no backoff", RetryPolicy{MaxAttempts: 3}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				got := tt.policy.backoff(tt.attempt)
+				if got < 0 || got > tt.max || (tt.max > 0 && got == 0) {
+					t.Fatalf("backoff(%d) = %s, ожидалось в (0, %s]", tt.attempt, got, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3}
+	serialization := &pq.Error{Code: "40001"}
+	deadlock := fmt.Errorf("обёртка: %w", &pq.Error{Code: "40P01"})
+
+	tests := []struct {
+		name    string
+		policy  *RetryPolicy
+		attempt int
+		err     error
+		want    bool
+	}{
+		{"serialization failure", p, 1, serialization, true},
+		{"wrapped deadlock", p, 2, deadlock, true},
+		{"max attempts reached", p, 3, serialization, false},
+		{"past max attempts", p, 4, serialization, false},
+		{"no policy", nil, 1, serialization, false},
+		{"success", p, 1, nil, false},
+		{"unique violation", p, 1, &pq.Error{Code: "23505"}, false},
+		{"connection error", p, 1, &pq.Error{Code: "08006"}, false},
+		{"other error", p, 1, errors.New("ошибка приложения"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.shouldRetry(tt.attempt, tt.err); got != tt.want {
+				t.Fatalf("shouldRetry(%d, %v) = %v, ожидалось %v", tt.attempt, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// rollbackFailConnector выдаёт соединения, транзакции которых не удаётся откатить
+type rollbackFailConnector struct{}
+
+func (rollbackFailConnector) Connect(context.Context) (driver.Conn, error) {
+	return rollbackFailConn{fakeConn{name: "rollback-fail"}}, nil
+}
+func (rollbackFailConnector) Driver() driver.Driver { return nil }
+
+type rollbackFailConn struct {
+	fakeConn
+}
+
+func (rollbackFailConn) Begin() (driver.Tx, error) { return rollbackFailTx{}, nil }
+
+type rollbackFailTx struct{}
+
+func (rollbackFailTx) Commit() error   { return nil }
+func (rollbackFailTx) Rollback() error { return driver.ErrBadConn }
+
+func TestRunTransactionRollbackFailureKeepsCause(t *testing.T) {
+	d := &DB{pool: sql.OpenDB(rollbackFailConnector{})}
+	t.Cleanup(func() { _ = d.pool.Close() })
+
+	cause := &pq.Error{Code: "40001"}
+	err := d.runTransaction(context.Background(), func(context.Context) error {
+		return fmt.Errorf("обёртка: %w", cause)
+	}, txOptions{})
+
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("ошибка отката потеряна: %v", err)
+	}
+	if got := ErrorClassOf(err); got != ClassSerializationFailure {
+		t.Fatalf("ErrorClassOf = %v, ожидался ClassSerializationFailure: %v", got, err)
+	}
+	if !isRetryableTxError(err) {
+		t.Fatalf("ошибка сериализации за неудачным откатом должна повторяться: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UserCollision — не удалённые пользователи, у которых значения столбца
+// Column совпадают после нормализации
+type UserCollision struct {
+	Column string   // "username" или "email"
+	Key    string   // общее нормализованное значение
+	IDs    []string // пользователи в порядке создания
+	Values []string // хранимые значения в том же порядке
+}
+
+// UserCollisionError — нормализация невозможна, пока совпадения не разрешены
+type UserCollisionError struct {
+	Collisions []UserCollision
+}
+
+// Error перечисляет совпавшие значения
+func (e *UserCollisionError) Error() string {
+	keys := make([]string, len(e.Collisions))
+	for i, c := range e.Collisions {
+		keys[i] = c.Column + " " + c.Key
+	}
+	return fmt.Sprintf("%s: %s", ErrUserCollision.Error(), strings.Join(keys, ", "))
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrUserCollision)
+func (e *UserCollisionError) Unwrap() error {
+	return ErrUserCollision
+}
+
+// FindUserCollisions ищет не удалённых пользователей, username или email
+// которых совпадают после нормализации n (nil — DefaultNormalizer). Такие
+// записи нарушили бы уникальные индексы без учёта регистра, поэтому их нужно
+// разрешить до миграции 0006 и до NormalizeUsers.
+func FindUserCollisions(ctx context.Context, exec Executor, n *Normalizer) ([]UserCollision, error) {
+	if n == nil {
+		n = DefaultNormalizer
+	}
+
+	rows, err := exec.QueryContext(ctx, `
+		SELECT id, username, email
+		FROM users
+		WHERE deleted_at IS NULL
+		ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", ClassifyError(err))
+	}
+	defer rows.Close()
+
+	type columnKey struct{ column, key string }
+	groups := map[columnKey]*UserCollision{}
+	add := func(column, key, id, value string) {
+		k := columnKey{column, key}
+		g, ok := groups[k]
+		if !ok {
+			g = &UserCollision{Column: column, Key: key}
+			groups[k] = g
+		}
+		g.IDs = append(g.IDs, id)
+		g.Values = append(g.Values, value)
+	}
+
+	for rows.Next() {
+		var id, username, email string
+		if err := rows.Scan(&id, &username, &email); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", ClassifyError(err))
+		}
+		add("username", n.Username(username), id, username)
+		add("email", n.Email(email), id, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", ClassifyError(err))
+	}
+
+	var collisions []UserCollision
+	for _, g := range groups {
+		if len(g.IDs) > 1 {
+			collisions = append(collisions, *g)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		if collisions[i].Column != collisions[j].Column {
+			return collisions[i].Column > collisions[j].Column // сначала username
+		}
+		return collisions[i].Key < collisions[j].Key
+	})
+	return collisions, nil
+}
+
+// NormalizeUsers приводит хранимые username и email всех пользователей, в том
+// числе удалённых, и username в истории входов к виду n (nil —
+// DefaultNormalizer) и возвращает число изменённых пользователей. Таблица блокируется от записи на время работы; если
+// FindUserCollisions находит совпадения, ничего не меняется и возвращается
+// *UserCollisionError.
+func NormalizeUsers(ctx context.Context, db *sql.DB, n *Normalizer) (int64, error) {
+	if n == nil {
+		n = DefaultNormalizer
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", ClassifyError(err))
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return 0, fmt.Errorf("failed to lock users: %w", ClassifyError(err))
+	}
+
+	collisions, err := FindUserCollisions(ctx, tx, n)
+	if err != nil {
+		return 0, err
+	}
+	if len(collisions) > 0 {
+		return 0, &UserCollisionError{Collisions: collisions}
+	}
+
+	// Обновлённые значения собираются заранее: запросы нельзя выполнять,
+	// пока открыт курсор в той же транзакции
+	type change struct{ id, username, email string }
+	var changes []change
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, username, email FROM users")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list users: %w", ClassifyError(err))
+	}
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.id, &c.username, &c.email); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan user: %w", ClassifyError(err))
+		}
+		username, email := n.Username(c.username), n.Email(c.email)
+		if username != c.username || email != c.email {
+			changes = append(changes, change{id: c.id, username: username, email: email})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows iteration error: %w", ClassifyError(err))
+	}
+
+	for _, c := range changes {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE users
+			SET username = $1, email = $2, updated_at = NOW(), version = version + 1
+			WHERE id = $3`,
+			c.username, c.email, c.id,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to normalize user %s: %w", c.id, ClassifyError(err))
+		}
+	}
+
+	if err := normalizeLoginUsernames(ctx, tx, n); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit normalization: %w", ClassifyError(err))
+	}
+	if logg != nil && len(changes) > 0 {
+		logg.Info("🔤 Нормализованы username и email пользователей: %d", len(changes))
+	}
+	return int64(len(changes)), nil
+}
+
+// normalizeLoginUsernames приводит username в истории входов к виду n, чтобы
+// GetFailedLogins учитывал и записи, сохранённые до нормализации
+func normalizeLoginUsernames(ctx context.Context, tx *sql.Tx, n *Normalizer) error {
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT username FROM user_logins")
+	if err != nil {
+		return fmt.Errorf("failed to list login usernames: %w", ClassifyError(err))
+	}
+	var stale []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan login username: %w", ClassifyError(err))
+		}
+		if n.Username(username) != username {
+			stale = append(stale, username)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows iteration error: %w", ClassifyError(err))
+	}
+
+	for _, username := range stale {
+		_, err := tx.ExecContext(ctx, "UPDATE user_logins SET username = $1 WHERE username = $2", n.Username(username), username)
+		if err != nil {
+			return fmt.Errorf("failed to normalize login username: %w", ClassifyError(err))
+		}
+	}
+	return nil
+}
@@ -26,69 +26,112 @@ type UserLogin struct {
 	FailReason sql.NullString
 }
 
-// UserLoginRepository определяет интерфейс для работы с историей входов
+// UserLoginRepository определяет интерфейс для работы с историей входов.
+// Если ctx несёт транзакцию RunInTransaction, методы выполняются в ней.
 type UserLoginRepository interface {
 	Save(ctx context.Context, userID, username, ip, userAgent, sessionID string, loginTime time.Time, success bool, failReason string) error
 	UpdateLogoutTime(ctx context.Context, sessionID string, logoutTime time.Time) error
 	GetBySessionID(ctx context.Context, sessionID string) (*UserLogin, error)
 	GetLastUserLogins(ctx context.Context, userID string, limit int) ([]*UserLogin, error)
+	GetUserLoginsPage(ctx context.Context, userID string, limit int, cursor string) (*UserLoginPage, error)
 	GetFailedLogins(ctx context.Context, username string, since time.Time) (int, error)
 	CleanupOldRecords(ctx context.Context, before time.Time) (int64, error)
+	WithTx(tx *sql.Tx) UserLoginRepository
 }
 
+var _ UserLoginRepository = (*UserLoginRepositoryImpl)(nil)
+
 type UserLoginRepositoryImpl struct {
-	db *sql.DB
+	conns connProvider
+	ins   instrumentation
+	norm  *Normalizer
 }
 
 // NewUserLoginRepository создает новый репозиторий для работы с историей входов
 func NewUserLoginRepository(db *sql.DB) *UserLoginRepositoryImpl {
-	return &UserLoginRepositoryImpl{db: db}
+	return NewUserLoginRepositoryWithNormalizer(db, nil)
+}
+
+// NewUserLoginRepositoryWithNormalizer создает репозиторий истории входов,
+// приводящий username к виду n; nil означает DefaultNormalizer. Нормализатор
+// должен совпадать с нормализатором репозитория пользователей.
+func NewUserLoginRepositoryWithNormalizer(db *sql.DB, n *Normalizer) *UserLoginRepositoryImpl {
+	return &UserLoginRepositoryImpl{conns: singleConn{exec: db}, ins: instrumentation{repo: "user_logins", metrics: DefaultMetrics}, norm: n}
+}
+
+// WithTx возвращает копию репозитория, все запросы которой выполняются в транзакции tx
+func (r *UserLoginRepositoryImpl) WithTx(tx *sql.Tx) UserLoginRepository {
+	return &UserLoginRepositoryImpl{conns: singleConn{exec: tx}, ins: r.ins, norm: r.norm}
+}
+
+// normalizer возвращает нормализатор репозитория
+func (r *UserLoginRepositoryImpl) normalizer() *Normalizer {
+	if r.norm == nil {
+		return DefaultNormalizer
+	}
+	return r.norm
 }
 
-// Save сохраняет информацию о входе пользователя
+// Save сохраняет информацию о входе пользователя. username хранится
+// нормализованным, как в репозитории пользователей.
 func (r *UserLoginRepositoryImpl) Save(
 	ctx context.Context,
 	userID, username, ip, userAgent, sessionID string,
 	loginTime time.Time,
 	success bool,
 	failReason string,
-) error {
+) (err error) {
+	query := `INSERT INTO user_logins (
+			user_id, username, ip, user_agent, login_time, 
+			session_id, success, fail_reason
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
 	var reason sql.NullString
 	if failReason != "" {
 		reason = sql.NullString{String: failReason, Valid: true}
 	}
 
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO user_logins (
-			user_id, username, ip, user_agent, login_time, 
-			session_id, success, fail_reason
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		userID, username, ip, userAgent, loginTime,
+	args := []any{
+		userID, r.normalizer().Username(username), ip, userAgent, loginTime,
 		sessionID, success, reason,
-	)
+	}
+	ctx, q, err := r.ins.start(ctx, "Save", query, args...)
+	defer q.finish(&err)
+	if err != nil {
+		return err
+	}
+
+	_, err = writerFor(ctx, r.conns).ExecContext(ctx, query, args...)
 
 	if err != nil {
-		return fmt.Errorf("failed to save user login: %w", err)
+		return fmt.Errorf("failed to save user login: %w", ClassifyError(err))
 	}
+	q.rows = 1
 	return nil
 }
 
 // UpdateLogoutTime обновляет время выхода пользователя
-func (r *UserLoginRepositoryImpl) UpdateLogoutTime(ctx context.Context, sessionID string, logoutTime time.Time) error {
-	result, err := r.db.ExecContext(ctx,
-		`UPDATE user_logins SET logout_time = $1 WHERE session_id = $2`,
-		logoutTime, sessionID,
-	)
+func (r *UserLoginRepositoryImpl) UpdateLogoutTime(ctx context.Context, sessionID string, logoutTime time.Time) (err error) {
+	query := `UPDATE user_logins SET logout_time = $1 WHERE session_id = $2`
+
+	ctx, q, err := r.ins.start(ctx, "UpdateLogoutTime", query, logoutTime, sessionID)
+	defer q.finish(&err)
+	if err != nil {
+		return err
+	}
+
+	result, err := writerFor(ctx, r.conns).ExecContext(ctx, query, logoutTime, sessionID)
 
 	if err != nil {
-		return fmt.Errorf("failed to update logout time: %w", err)
+		return fmt.Errorf("failed to update logout time: %w", ClassifyError(err))
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to get rows affected: %w", ClassifyError(err))
 	}
 
+	q.rows = rowsAffected
 	if rowsAffected == 0 {
 		return ErrLoginNotFound
 	}
@@ -97,16 +140,21 @@ func (r *UserLoginRepositoryImpl) UpdateLogoutTime(ctx context.Context, sessionI
 }
 
 // GetBySessionID возвращает запись о входе по идентификатору сессии
-func (r *UserLoginRepositoryImpl) GetBySessionID(ctx context.Context, sessionID string) (*UserLogin, error) {
-	login := &UserLogin{}
-	err := r.db.QueryRowContext(ctx,
-		`SELECT 
+func (r *UserLoginRepositoryImpl) GetBySessionID(ctx context.Context, sessionID string) (_ *UserLogin, err error) {
+	query := `SELECT 
 			id, user_id, username, ip, user_agent, 
 			login_time, logout_time, session_id, success, fail_reason
 		FROM user_logins 
-		WHERE session_id = $1`,
-		sessionID,
-	).Scan(
+		WHERE session_id = $1`
+
+	ctx, q, err := r.ins.start(ctx, "GetBySessionID", query, sessionID)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	login := &UserLogin{}
+	err = writerFor(ctx, r.conns).QueryRowContext(ctx, query, sessionID).Scan(
 		&login.ID, &login.UserID, &login.Username, &login.IP, &login.UserAgent,
 		&login.LoginTime, &login.LogoutTime, &login.SessionID, &login.Success, &login.FailReason,
 	)
@@ -115,27 +163,33 @@ func (r *UserLoginRepositoryImpl) GetBySessionID(ctx context.Context, sessionID
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrLoginNotFound
 		}
-		return nil, fmt.Errorf("failed to get login by session ID: %w", err)
+		return nil, fmt.Errorf("failed to get login by session ID: %w", ClassifyError(err))
 	}
 
+	q.rows = 1
 	return login, nil
 }
 
 // GetLastUserLogins возвращает последние записи о входах пользователя
-func (r *UserLoginRepositoryImpl) GetLastUserLogins(ctx context.Context, userID string, limit int) ([]*UserLogin, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT 
+func (r *UserLoginRepositoryImpl) GetLastUserLogins(ctx context.Context, userID string, limit int) (_ []*UserLogin, err error) {
+	query := `SELECT 
 			id, user_id, username, ip, user_agent, 
 			login_time, logout_time, session_id, success, fail_reason
 		FROM user_logins 
 		WHERE user_id = $1
 		ORDER BY login_time DESC
-		LIMIT $2`,
-		userID, limit,
-	)
+		LIMIT $2`
+
+	ctx, q, err := r.ins.start(ctx, "GetLastUserLogins", query, userID, limit)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := readerFor(ctx, r.conns).QueryContext(ctx, query, userID, limit)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to query user logins: %w", err)
+		return nil, fmt.Errorf("failed to query user logins: %w", ClassifyError(err))
 	}
 	defer rows.Close()
 
@@ -147,50 +201,66 @@ func (r *UserLoginRepositoryImpl) GetLastUserLogins(ctx context.Context, userID
 			&login.LoginTime, &login.LogoutTime, &login.SessionID, &login.Success, &login.FailReason,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan login record: %w", err)
+			return nil, fmt.Errorf("failed to scan login record: %w", ClassifyError(err))
 		}
 		logins = append(logins, login)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %w", err)
+		return nil, fmt.Errorf("rows iteration error: %w", ClassifyError(err))
 	}
 
+	q.rows = int64(len(logins))
 	return logins, nil
 }
 
-// GetFailedLogins возвращает количество неудачных попыток входа для пользователя
-func (r *UserLoginRepositoryImpl) GetFailedLogins(ctx context.Context, username string, since time.Time) (int, error) {
-	var count int
-	err := r.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) 
+// GetFailedLogins возвращает количество неудачных попыток входа для
+// пользователя. username нормализуется, поэтому попытки под «Bob» и «BOB»
+// считаются вместе.
+func (r *UserLoginRepositoryImpl) GetFailedLogins(ctx context.Context, username string, since time.Time) (_ int, err error) {
+	username = r.normalizer().Username(username)
+	query := `SELECT COUNT(*) 
 		FROM user_logins 
-		WHERE username = $1 AND success = false AND login_time > $2`,
-		username, since,
-	).Scan(&count)
+		WHERE username = $1 AND success = false AND login_time > $2`
+
+	ctx, q, err := r.ins.start(ctx, "GetFailedLogins", query, username, since)
+	defer q.finish(&err)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = readerFor(ctx, r.conns).QueryRowContext(ctx, query, username, since).Scan(&count)
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to count failed logins: %w", err)
+		return 0, fmt.Errorf("failed to count failed logins: %w", ClassifyError(err))
 	}
 
+	q.rows = 1
 	return count, nil
 }
 
 // CleanupOldRecords удаляет старые записи о входах
-func (r *UserLoginRepositoryImpl) CleanupOldRecords(ctx context.Context, before time.Time) (int64, error) {
-	result, err := r.db.ExecContext(ctx,
-		`DELETE FROM user_logins WHERE login_time < $1`,
-		before,
-	)
+func (r *UserLoginRepositoryImpl) CleanupOldRecords(ctx context.Context, before time.Time) (_ int64, err error) {
+	query := `DELETE FROM user_logins WHERE login_time < $1`
+
+	ctx, q, err := r.ins.start(ctx, "CleanupOldRecords", query, before)
+	defer q.finish(&err)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := writerFor(ctx, r.conns).ExecContext(ctx, query, before)
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to cleanup old login records: %w", err)
+		return 0, fmt.Errorf("failed to cleanup old login records: %w", ClassifyError(err))
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		return 0, fmt.Errorf("failed to get rows affected: %w", ClassifyError(err))
 	}
 
+	q.rows = rowsAffected
 	return rowsAffected, nil
 }
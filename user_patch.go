@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UserPatch перечисляет изменяемые поля пользователя: nil означает «не
+// менять». Для LastLoginAt и PasswordChanged значение с Valid=false
+// сбрасывает столбец в NULL.
+type UserPatch struct {
+	Username        *string
+	Email           *string
+	Role            *string
+	Confirmed       *bool
+	LastLoginAt     *sql.NullTime
+	PasswordChanged *sql.NullTime
+
+	// Version, если не 0, применяет изменения только к этой версии записи;
+	// иначе возвращается *ConcurrentUpdateError
+	Version int64
+}
+
+// empty сообщает, что патч не меняет ни одного поля
+func (p UserPatch) empty() bool {
+	return p.Username == nil && p.Email == nil && p.Role == nil && p.Confirmed == nil &&
+		p.LastLoginAt == nil && p.PasswordChanged == nil
+}
+
+// UpdateUserFields изменяет только заданные в patch поля и возвращает
+// обновлённого пользователя. Пустой патч ничего не записывает и возвращает
+// текущую запись. Если пользователя нет или он удалён, возвращается
+// ErrUserNotFound.
+func (r *userRepo) UpdateUserFields(ctx context.Context, id string, patch UserPatch) (_ *User, err error) {
+	if patch.empty() {
+		return r.reloadUser(ctx, id, patch.Version)
+	}
+
+	b := &userQuery{}
+	var set []string
+	add := func(col string, val any) {
+		set = append(set, col+" = "+b.next(val))
+	}
+	if patch.Username != nil {
+		add("username", r.normalizer().Username(*patch.Username))
+	}
+	if patch.Email != nil {
+		add("email", r.normalizer().Email(*patch.Email))
+	}
+	if patch.Role != nil {
+		add("role", *patch.Role)
+	}
+	if patch.Confirmed != nil {
+		add("confirmed", *patch.Confirmed)
+	}
+	if patch.LastLoginAt != nil {
+		add("last_login_at", *patch.LastLoginAt)
+	}
+	if patch.PasswordChanged != nil {
+		add("password_changed", *patch.PasswordChanged)
+	}
+	set = append(set, "updated_at = NOW()", "version = version + 1")
+
+	b.add("id = ?", id)
+	b.where = append(b.where, "deleted_at IS NULL")
+	if patch.Version != 0 {
+		b.add("version = ?", patch.Version)
+	}
+
+	query := `
+		UPDATE users
+		SET ` + strings.Join(set, ", ") + `
+		` + b.whereClause() + `
+		RETURNING ` + userColumns
+
+	ctx, q, err := r.ins.start(ctx, "UpdateUserFields", query, b.args...)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx, query, b.args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.explainNoRows(ctx, id, patch.Version)
+		}
+		err = ClassifyError(err)
+		if isDuplicateUserError(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update user fields: %w", err)
+	}
+	q.rows = 1
+	return user, nil
+}
+
+// reloadUser читает пользователя с основного пула, проверяя версию, если она задана
+func (r *userRepo) reloadUser(ctx context.Context, id string, version int64) (*User, error) {
+	user, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = $1 AND deleted_at IS NULL`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to reload user: %w", ClassifyError(err))
+	}
+	if version != 0 && user.Version != version {
+		return nil, &ConcurrentUpdateError{Version: version, Current: user}
+	}
+	return user, nil
+}
+
+// explainNoRows определяет, почему условное обновление не затронуло строк:
+// пользователя нет (ErrUserNotFound) или версия уже другая (*ConcurrentUpdateError)
+func (r *userRepo) explainNoRows(ctx context.Context, id string, version int64) error {
+	current, err := r.reloadUser(ctx, id, version)
+	if err != nil {
+		return err
+	}
+	// Строка есть и версия совпала — её изменили между UPDATE и чтением
+	return &ConcurrentUpdateError{Version: version, Current: current}
+}
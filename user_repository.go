@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -15,248 +16,446 @@ type User struct {
 	Email           string
 	Role            string
 	Confirmed       bool
-	ConfirmToken    string
+	ConfirmToken    string // хэш токена подтверждения (HashConfirmToken); пустой, если токена нет
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 	LastLoginAt     sql.NullTime
 	PasswordChanged sql.NullTime
+	DeletedAt       sql.NullTime // время мягкого удаления; Valid только для удалённых
+	Version         int64        // увеличивается при каждом изменении записи
+
+	ConfirmTokenIssuedAt  sql.NullTime // когда выпущен текущий токен подтверждения
+	ConfirmTokenExpiresAt sql.NullTime // когда он перестаёт действовать
+}
+
+// userColumns — столбцы users в порядке, ожидаемом scanUser
+const userColumns = `id, username, password, email, role, confirmed, confirm_token,
+		       created_at, updated_at, last_login_at, password_changed, deleted_at, version,
+		       confirm_token_issued_at, confirm_token_expires_at`
+
+// scanUser читает пользователя из строки, выбранной по userColumns
+func scanUser(row interface{ Scan(dest ...any) error }) (*User, error) {
+	user := &User{}
+	err := row.Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.Role,
+		&user.Confirmed, &user.ConfirmToken, &user.CreatedAt, &user.UpdatedAt,
+		&user.LastLoginAt, &user.PasswordChanged, &user.DeletedAt, &user.Version,
+		&user.ConfirmTokenIssuedAt, &user.ConfirmTokenExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 type userRepo struct {
-	db *sql.DB
+	conns  connProvider
+	ins    instrumentation
+	norm   *Normalizer
+	tokens *ConfirmTokenPolicy
 }
 
 // NewUserRepository создает новый экземпляр репозитория пользователей
 func NewUserRepository(db *sql.DB) UserRepository {
-	return &userRepo{db: db}
+	return NewUserRepositoryWithNormalizer(db, nil)
 }
 
-// GetUserByID возвращает пользователя по ID
-func (r *userRepo) GetUserByID(id string) (*User, error) {
+// NewUserRepositoryWithNormalizer создает репозиторий пользователей, приводящий
+// username и email к виду n; nil означает DefaultNormalizer
+func NewUserRepositoryWithNormalizer(db *sql.DB, n *Normalizer) UserRepository {
+	return &userRepo{conns: singleConn{exec: db}, ins: instrumentation{repo: "users", metrics: DefaultMetrics}, norm: n}
+}
+
+// WithTx возвращает копию репозитория, все запросы которой выполняются в транзакции tx
+func (r *userRepo) WithTx(tx *sql.Tx) UserRepository {
+	return &userRepo{conns: singleConn{exec: tx}, ins: r.ins, norm: r.norm, tokens: r.tokens}
+}
+
+// normalizer возвращает нормализатор репозитория
+func (r *userRepo) normalizer() *Normalizer {
+	if r.norm == nil {
+		return DefaultNormalizer
+	}
+	return r.norm
+}
+
+// GetUserByIDContext возвращает пользователя по ID
+func (r *userRepo) GetUserByIDContext(ctx context.Context, id string) (_ *User, err error) {
 	query := `
-		SELECT id, username, password, email, role, confirmed, confirm_token, 
-		       created_at, updated_at, last_login_at, password_changed
-		FROM users 
-		WHERE id = $1`
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1` + notDeleted(ctx)
 
-	user := &User{}
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.Role,
-		&user.Confirmed, &user.ConfirmToken, &user.CreatedAt, &user.UpdatedAt,
-		&user.LastLoginAt, &user.PasswordChanged,
-	)
+	ctx, q, err := r.ins.start(ctx, "GetUserByID", query, id)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(readerFor(ctx, r.conns).QueryRowContext(ctx, query, id))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
-		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+		return nil, fmt.Errorf("failed to get user by ID: %w", ClassifyError(err))
 	}
+	q.rows = 1
 	return user, nil
 }
 
-// GetUserByUsername возвращает пользователя по имени пользователя
-func (r *userRepo) GetUserByUsername(username string) (*User, error) {
+// GetUserByUsernameContext возвращает пользователя по имени пользователя без
+// учёта регистра и формы записи (см. Normalizer)
+func (r *userRepo) GetUserByUsernameContext(ctx context.Context, username string) (_ *User, err error) {
+	username = r.normalizer().Username(username)
 	query := `
-		SELECT id, username, password, email, role, confirmed, confirm_token,
-		       created_at, updated_at, last_login_at, password_changed
-		FROM users 
-		WHERE username = $1`
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE lower(username) = $1` + notDeleted(ctx)
 
-	user := &User{}
-	err := r.db.QueryRow(query, username).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.Role,
-		&user.Confirmed, &user.ConfirmToken, &user.CreatedAt, &user.UpdatedAt,
-		&user.LastLoginAt, &user.PasswordChanged,
-	)
+	ctx, q, err := r.ins.start(ctx, "GetUserByUsername", query, username)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(readerFor(ctx, r.conns).QueryRowContext(ctx, query, username))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
-		return nil, fmt.Errorf("failed to get user by username: %w", err)
+		return nil, fmt.Errorf("failed to get user by username: %w", ClassifyError(err))
 	}
+	q.rows = 1
 	return user, nil
 }
 
-// GetUserByEmail возвращает пользователя по email
-func (r *userRepo) GetUserByEmail(email string) (*User, error) {
+// GetUserByEmailContext возвращает пользователя по email без учёта регистра
+// и формы записи (см. Normalizer)
+func (r *userRepo) GetUserByEmailContext(ctx context.Context, email string) (_ *User, err error) {
+	email = r.normalizer().Email(email)
 	query := `
-		SELECT id, username, password, email, role, confirmed, confirm_token,
-		       created_at, updated_at, last_login_at, password_changed
-		FROM users 
-		WHERE email = $1`
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE lower(email) = $1` + notDeleted(ctx)
 
-	user := &User{}
-	err := r.db.QueryRow(query, email).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.Role,
-		&user.Confirmed, &user.ConfirmToken, &user.CreatedAt, &user.UpdatedAt,
-		&user.LastLoginAt, &user.PasswordChanged,
-	)
+	ctx, q, err := r.ins.start(ctx, "GetUserByEmail", query, email)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(readerFor(ctx, r.conns).QueryRowContext(ctx, query, email))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		return nil, fmt.Errorf("failed to get user by email: %w", ClassifyError(err))
 	}
+	q.rows = 1
 	return user, nil
 }
 
-// ExistsByUsername проверяет существование пользователя с заданным именем
-func (r *userRepo) ExistsByUsername(username string) (bool, error) {
+// ExistsByUsernameContext проверяет существование пользователя с заданным именем
+func (r *userRepo) ExistsByUsernameContext(ctx context.Context, username string) (_ bool, err error) {
 	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)"
-	err := r.db.QueryRow(query, username).Scan(&exists)
+	username = r.normalizer().Username(username)
+	query := "SELECT EXISTS(SELECT 1 FROM users WHERE lower(username) = $1" + notDeleted(ctx) + ")"
+
+	ctx, q, err := r.ins.start(ctx, "ExistsByUsername", query, username)
+	defer q.finish(&err)
 	if err != nil {
-		return false, fmt.Errorf("failed to check username existence: %w", err)
+		return false, err
+	}
+
+	err = readerFor(ctx, r.conns).QueryRowContext(ctx, query, username).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check username existence: %w", ClassifyError(err))
 	}
 	return exists, nil
 }
 
-// ExistsByEmail проверяет существование пользователя с заданным email
-func (r *userRepo) ExistsByEmail(email string) (bool, error) {
+// ExistsByEmailContext проверяет существование пользователя с заданным email
+func (r *userRepo) ExistsByEmailContext(ctx context.Context, email string) (_ bool, err error) {
 	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)"
-	err := r.db.QueryRow(query, email).Scan(&exists)
+	email = r.normalizer().Email(email)
+	query := "SELECT EXISTS(SELECT 1 FROM users WHERE lower(email) = $1" + notDeleted(ctx) + ")"
+
+	ctx, q, err := r.ins.start(ctx, "ExistsByEmail", query, email)
+	defer q.finish(&err)
+	if err != nil {
+		return false, err
+	}
+
+	err = readerFor(ctx, r.conns).QueryRowContext(ctx, query, email).Scan(&exists)
 	if err != nil {
-		return false, fmt.Errorf("failed to check email existence: %w", err)
+		return false, fmt.Errorf("failed to check email existence: %w", ClassifyError(err))
 	}
 	return exists, nil
 }
 
-// CreateUserExtended создает нового пользователя с расширенными полями
-func (r *userRepo) CreateUserExtended(username, passwordHash, email, role string, confirmed bool, confirmToken string) (string, error) {
-	var userID string
+// CreateUserExtendedContext создает нового пользователя с расширенными полями.
+// Username и email сохраняются в нормализованном виде, confirmToken — в виде
+// хэша со сроком действия из ConfirmTokenPolicy.
+func (r *userRepo) CreateUserExtendedContext(ctx context.Context, username, passwordHash, email, role string, confirmed bool, confirmToken string) (string, error) {
+	user, err := r.CreateUserExtendedReturning(ctx, username, passwordHash, email, role, confirmed, confirmToken)
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// CreateUserExtendedReturning создает пользователя и возвращает созданную запись
+func (r *userRepo) CreateUserExtendedReturning(ctx context.Context, username, passwordHash, email, role string, confirmed bool, confirmToken string) (_ *User, err error) {
+	username, email = r.normalizer().Username(username), r.normalizer().Email(email)
 	query := `
-		INSERT INTO users (username, password, email, role, confirmed, confirm_token)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id`
+		INSERT INTO users (username, password, email, role, confirmed, confirm_token,
+		                   confirm_token_issued_at, confirm_token_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6,
+		        CASE WHEN $6 <> '' THEN NOW() END,
+		        CASE WHEN $6 <> '' THEN NOW() + make_interval(secs => $7) END)
+		RETURNING ` + userColumns
+	args := []any{username, passwordHash, email, role, confirmed, HashConfirmToken(confirmToken), r.tokenPolicy().TTL.Seconds()}
+
+	ctx, q, err := r.ins.start(ctx, "CreateUserExtended", query, args...)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
 
-	err := r.db.QueryRow(query, username, passwordHash, email, role, confirmed, confirmToken).Scan(&userID)
+	user, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx, query, args...))
 
 	if err != nil {
-		// Проверяем на нарушение уникальности
-		if isUniqueConstraintError(err, "username") {
-			return "", ErrDuplicateUsername
+		// Нарушение уникальности возвращаем как есть: errors.Is сработает
+		// для ErrDuplicateUsername/ErrDuplicateEmail
+		err = ClassifyError(err)
+		if isDuplicateUserError(err) {
+			return nil, err
 		}
-		if isUniqueConstraintError(err, "email") {
-			return "", ErrDuplicateEmail
-		}
-		return "", fmt.Errorf("failed to create user: %w", err)
+		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
-	return userID, nil
+	q.rows = 1
+	return user, nil
+}
+
+// UpdateUserContext обновляет данные пользователя, если запись не менялась с
+// момента чтения: user.Version должна совпадать с текущей версией. Иначе
+// возвращается *ConcurrentUpdateError (errors.Is(err, ErrConcurrentUpdate))
+// с актуальной записью, в том числе для записи, собранной вручную без версии
+// (Version 0). Перезаписать пользователя без проверки версии можно только
+// явно, с контекстом из WithoutVersionCheck. После успешного обновления *user содержит новую
+// версию, updated_at и нормализованные username и email. Если пользователя
+// нет, возвращается ErrUserNotFound.
+func (r *userRepo) UpdateUserContext(ctx context.Context, user *User) error {
+	updated, err := r.UpdateUserReturning(ctx, user)
+	if err != nil {
+		return err
+	}
+	*user = *updated
+	return nil
 }
 
-// UpdateUser обновляет данные пользователя
-func (r *userRepo) UpdateUser(user *User) error {
+// UpdateUserReturning работает как UpdateUserContext, но не изменяет user,
+// а возвращает обновлённую запись
+func (r *userRepo) UpdateUserReturning(ctx context.Context, user *User) (_ *User, err error) {
 	query := `
 		UPDATE users 
 		SET username = $1, email = $2, role = $3, confirmed = $4, 
-		    updated_at = NOW(), last_login_at = $5, password_changed = $6
-		WHERE id = $7`
-
-	_, err := r.db.Exec(query,
-		user.Username, user.Email, user.Role, user.Confirmed,
-		user.LastLoginAt, user.PasswordChanged, user.ID,
-	)
+		    updated_at = NOW(), last_login_at = $5, password_changed = $6,
+		    version = version + 1
+		WHERE id = $7 AND ($9 OR version = $8) AND deleted_at IS NULL
+		RETURNING ` + userColumns
+
+	args := []any{
+		r.normalizer().Username(user.Username), r.normalizer().Email(user.Email), user.Role, user.Confirmed,
+		user.LastLoginAt, user.PasswordChanged, user.ID, user.Version, VersionCheckSkipped(ctx),
+	}
+	ctx, q, err := r.ins.start(ctx, "UpdateUser", query, args...)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
 
+	updated, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx, query, args...))
 	if err != nil {
-		if isUniqueConstraintError(err, "username") {
-			return ErrDuplicateUsername
+		if errors.Is(err, sql.ErrNoRows) {
+			// Запись не обновлена: либо её нет, либо версия уже другая
+			if user.Version == 0 && logg != nil {
+				logg.Warn("⚠️ UpdateUser без версии для пользователя %s отклонён: прочитайте запись перед изменением или используйте WithoutVersionCheck", user.ID)
+			}
+			return nil, r.explainNoRows(ctx, user.ID, user.Version)
 		}
-		if isUniqueConstraintError(err, "email") {
-			return ErrDuplicateEmail
+		err = ClassifyError(err)
+		if isDuplicateUserError(err) {
+			return nil, err
 		}
-		return fmt.Errorf("failed to update user: %w", err)
+		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
-	return nil
+	q.rows = 1
+	return updated, nil
 }
 
-// DeleteUser удаляет пользователя по ID
-func (r *userRepo) DeleteUser(id string) error {
-	query := "DELETE FROM users WHERE id = $1"
-	_, err := r.db.Exec(query, id)
+// DeleteUserContext мягко удаляет пользователя по ID: запись остаётся в
+// таблице с deleted_at и может быть восстановлена RestoreUser до
+// PurgeDeletedUsers. Если пользователя нет или он уже удалён, возвращается
+// ErrUserNotFound.
+func (r *userRepo) DeleteUserContext(ctx context.Context, id string) error {
+	_, err := r.DeleteUserReturning(ctx, id)
+	return err
+}
+
+// DeleteUserReturning мягко удаляет пользователя и возвращает удалённую запись
+func (r *userRepo) DeleteUserReturning(ctx context.Context, id string) (_ *User, err error) {
+	query := `
+		UPDATE users
+		SET deleted_at = NOW(), updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + userColumns
+
+	ctx, q, err := r.ins.start(ctx, "DeleteUser", query, id)
+	defer q.finish(&err)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return nil, err
 	}
-	return nil
+
+	user, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to delete user: %w", ClassifyError(err))
+	}
+	q.rows = 1
+	return user, nil
 }
 
-// ConfirmUser подтверждает пользователя по email и токену
-func (r *userRepo) ConfirmUser(email, token string) error {
+// ConfirmUserContext подтверждает пользователя по email и токену. Если
+// пользователя с таким email нет, возвращается ErrUserNotFound, если он уже
+// подтверждён — ErrUserAlreadyConfirmed, для чужого токена —
+// ErrConfirmTokenInvalid, для просроченного — ErrConfirmTokenExpired.
+func (r *userRepo) ConfirmUserContext(ctx context.Context, email, token string) error {
+	_, err := r.ConfirmUserReturning(ctx, email, token)
+	return err
+}
+
+// ConfirmUserReturning подтверждает пользователя и возвращает обновлённую запись
+func (r *userRepo) ConfirmUserReturning(ctx context.Context, email, token string) (_ *User, err error) {
+	email = r.normalizer().Email(email)
 	query := `
 		UPDATE users 
-		SET confirmed = TRUE, confirm_token = ''
-		WHERE email = $1 AND confirm_token = $2 AND NOT confirmed`
-
-	result, err := r.db.Exec(query, email, token)
+		SET confirmed = TRUE, confirm_token = '', confirm_token_expires_at = NULL,
+		    version = version + 1
+		WHERE lower(email) = $1 AND confirm_token = $2 AND $2 <> '' AND NOT confirmed
+		  AND confirm_token_expires_at > NOW() AND deleted_at IS NULL
+		RETURNING ` + userColumns
+
+	hash := HashConfirmToken(token)
+	ctx, q, err := r.ins.start(ctx, "ConfirmUser", query, email, hash)
+	defer q.finish(&err)
 	if err != nil {
-		return fmt.Errorf("failed to confirm user: %w", err)
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	user, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx, query, email, hash))
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return ErrUserNotFound
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.explainConfirm(ctx, email, token)
+		}
+		return nil, fmt.Errorf("failed to confirm user: %w", ClassifyError(err))
 	}
-	return nil
+	q.rows = 1
+	return user, nil
 }
 
-// UpdatePassword обновляет хэш пароля пользователя
-func (r *userRepo) UpdatePassword(id, newHash string) error {
+// UpdatePasswordContext обновляет хэш пароля пользователя. Если пользователя
+// нет, возвращается ErrUserNotFound.
+func (r *userRepo) UpdatePasswordContext(ctx context.Context, id, newHash string) error {
+	_, err := r.UpdatePasswordReturning(ctx, id, newHash)
+	return err
+}
+
+// UpdatePasswordReturning обновляет хэш пароля и возвращает обновлённую запись
+func (r *userRepo) UpdatePasswordReturning(ctx context.Context, id, newHash string) (_ *User, err error) {
 	query := `
 		UPDATE users 
-		SET password = $1, password_changed = NOW()
-		WHERE id = $2`
+		SET password = $1, password_changed = NOW(), version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING ` + userColumns
 
-	_, err := r.db.Exec(query, newHash, id)
+	ctx, q, err := r.ins.start(ctx, "UpdatePassword", query, newHash, id)
+	defer q.finish(&err)
 	if err != nil {
-		return fmt.Errorf("failed to update password: %w", err)
+		return nil, err
 	}
-	return nil
+
+	user, err := scanUser(writerFor(ctx, r.conns).QueryRowContext(ctx, query, newHash, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to update password: %w", ClassifyError(err))
+	}
+	q.rows = 1
+	return user, nil
 }
 
-// GetUsersByRole возвращает список пользователей с определенной ролью
-func (r *userRepo) GetUsersByRole(role string, limit, offset int) ([]*User, error) {
+// GetUsersByRoleContext возвращает список пользователей с определенной ролью
+func (r *userRepo) GetUsersByRoleContext(ctx context.Context, role string, limit, offset int) (_ []*User, err error) {
 	query := `
-		SELECT id, username, password, email, role, confirmed, confirm_token,
-		       created_at, updated_at, last_login_at, password_changed
-		FROM users 
-		WHERE role = $1
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE role = $1` + notDeleted(ctx) + `
 		ORDER BY created_at DESC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.Query(query, role, limit, offset)
+	ctx, q, err := r.ins.start(ctx, "GetUsersByRole", query, role, limit, offset)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := readerFor(ctx, r.conns).QueryContext(ctx, query, role, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query users by role: %w", err)
+		return nil, fmt.Errorf("failed to query users by role: %w", ClassifyError(err))
 	}
 	defer rows.Close()
 
 	var users []*User
 	for rows.Next() {
-		user := &User{}
-		err := rows.Scan(
-			&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.Role,
-			&user.Confirmed, &user.ConfirmToken, &user.CreatedAt, &user.UpdatedAt,
-			&user.LastLoginAt, &user.PasswordChanged,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
+			return nil, fmt.Errorf("failed to scan user: %w", ClassifyError(err))
 		}
 		users = append(users, user)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %w", err)
+		return nil, fmt.Errorf("rows iteration error: %w", ClassifyError(err))
 	}
 
+	q.rows = int64(len(users))
 	return users, nil
 }
 
-// isUniqueConstraintError проверяет, является ли ошибка нарушением уникальности для указанного поля
-func isUniqueConstraintError(err error, field string) bool {
-	return err != nil && err.Error() == fmt.Sprintf("pq: duplicate key value violates unique constraint \"users_%s_key\"", field)
+// isDuplicateUserError проверяет, является ли ошибка нарушением уникальности username или email
+func isDuplicateUserError(err error) bool {
+	return errors.Is(err, ErrDuplicateUsername) || errors.Is(err, ErrDuplicateEmail)
+}
+
+// ConcurrentUpdateError — запись изменилась между чтением и UpdateUser
+type ConcurrentUpdateError struct {
+	Version int64 // версия, с которой пришёл вызывающий код
+	Current *User // актуальная запись
+}
+
+// Error описывает расхождение версий
+func (e *ConcurrentUpdateError) Error() string {
+	return fmt.Sprintf("%s: версия %d, текущая %d", ErrConcurrentUpdate.Error(), e.Version, e.Current.Version)
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrConcurrentUpdate)
+func (e *ConcurrentUpdateError) Unwrap() error {
+	return ErrConcurrentUpdate
 }
@@ -0,0 +1,84 @@
+package db
+
+import "context"
+
+// Методы без контекста сохранены для обратной совместимости и делегируют
+// вызов context-версиям с context.Background().
+
+// GetUserByID возвращает пользователя по ID
+//
+// Deprecated: используйте GetUserByIDContext.
+func (r *userRepo) GetUserByID(id string) (*User, error) {
+	return r.GetUserByIDContext(context.Background(), id)
+}
+
+// GetUserByUsername возвращает пользователя по имени пользователя
+//
+// Deprecated: используйте GetUserByUsernameContext.
+func (r *userRepo) GetUserByUsername(username string) (*User, error) {
+	return r.GetUserByUsernameContext(context.Background(), username)
+}
+
+// GetUserByEmail возвращает пользователя по email
+//
+// Deprecated: используйте GetUserByEmailContext.
+func (r *userRepo) GetUserByEmail(email string) (*User, error) {
+	return r.GetUserByEmailContext(context.Background(), email)
+}
+
+// ExistsByUsername проверяет существование пользователя с заданным именем
+//
+// Deprecated: используйте ExistsByUsernameContext.
+func (r *userRepo) ExistsByUsername(username string) (bool, error) {
+	return r.ExistsByUsernameContext(context.Background(), username)
+}
+
+// ExistsByEmail проверяет существование пользователя с заданным email
+//
+// Deprecated: используйте ExistsByEmailContext.
+func (r *userRepo) ExistsByEmail(email string) (bool, error) {
+	return r.ExistsByEmailContext(context.Background(), email)
+}
+
+// CreateUserExtended создает нового пользователя с расширенными полями
+//
+// Deprecated: используйте CreateUserExtendedContext.
+func (r *userRepo) CreateUserExtended(username, passwordHash, email, role string, confirmed bool, confirmToken string) (string, error) {
+	return r.CreateUserExtendedContext(context.Background(), username, passwordHash, email, role, confirmed, confirmToken)
+}
+
+// UpdateUser обновляет данные пользователя. user.Version должна совпадать с
+// текущей версией записи, как в UpdateUserContext.
+//
+// Deprecated: используйте UpdateUserContext.
+func (r *userRepo) UpdateUser(user *User) error {
+	return r.UpdateUserContext(context.Background(), user)
+}
+
+// DeleteUser мягко удаляет пользователя по ID
+//
+// Deprecated: используйте DeleteUserContext.
+func (r *userRepo) DeleteUser(id string) error {
+	return r.DeleteUserContext(context.Background(), id)
+}
+
+// ConfirmUser подтверждает пользователя по email и токену
+//
+// Deprecated: используйте ConfirmUserContext.
+func (r *userRepo) ConfirmUser(email, token string) error {
+	return r.ConfirmUserContext(context.Background(), email, token)
+}
+
+// UpdatePassword обновляет хэш пароля пользователя
+//
+// Deprecated: используйте UpdatePasswordContext.
+func (r *userRepo) UpdatePassword(id, newHash string) error {
+	return r.UpdatePasswordContext(context.Background(), id, newHash)
+}
+
+// GetUsersByRole возвращает список пользователей с определенной ролью
+//
+// Deprecated: используйте GetUsersByRoleContext.
+func (r *userRepo) GetUsersByRole(role string, limit, offset int) ([]*User, error) {
+	return r.GetUsersByRoleContext(context.Background(), role, limit, offset)
+}
@@ -0,0 +1,234 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSearchLimit — размер страницы SearchUsers, если Limit не задан
+const DefaultSearchLimit = 50
+
+// UserSortField — поле сортировки результатов SearchUsers
+type UserSortField int
+
+const (
+	SortByCreatedAt UserSortField = iota
+	SortByUpdatedAt
+	SortByUsername
+	SortByEmail
+	SortByLastLogin
+)
+
+// column возвращает выражение ORDER BY для поля. Строки сравниваются побайтно
+// (COLLATE "C"), чтобы порядок не зависел от локали базы.
+func (f UserSortField) column() (string, error) {
+	switch f {
+	case SortByCreatedAt:
+		return "created_at", nil
+	case SortByUpdatedAt:
+		return "updated_at", nil
+	case SortByUsername:
+		return `username COLLATE "C"`, nil
+	case SortByEmail:
+		return `email COLLATE "C"`, nil
+	case SortByLastLogin:
+		return "last_login_at", nil
+	default:
+		return "", fmt.Errorf("unknown sort field %d", f)
+	}
+}
+
+// UserSort — один ключ сортировки. Пользователи без LastLoginAt при
+// сортировке по SortByLastLogin идут последними в обоих направлениях.
+type UserSort struct {
+	Field UserSortField
+	Desc  bool
+}
+
+// UserFilter задаёт условия SearchUsers. Пустые поля не ограничивают выборку,
+// заданные объединяются через AND.
+type UserFilter struct {
+	Role           string
+	Confirmed      *bool
+	CreatedFrom    time.Time // created_at >= CreatedFrom
+	CreatedTo      time.Time // created_at < CreatedTo
+	LastLoginFrom  time.Time // last_login_at >= LastLoginFrom; пользователи без входов не попадают
+	LastLoginTo    time.Time // last_login_at < LastLoginTo; пользователи без входов не попадают
+	UsernamePrefix string    // без учёта регистра, нормализуется как username
+	EmailDomain    string    // часть email после @, без учёта регистра
+
+	// Sort — ключи сортировки по порядку; по умолчанию created_at DESC.
+	// Последним ключом всегда добавляется id, чтобы страницы не пересекались.
+	Sort   []UserSort
+	Limit  int // по умолчанию DefaultSearchLimit
+	Offset int
+
+	// CountTotal включает подсчёт всех подходящих пользователей без учёта Limit/Offset
+	CountTotal bool
+}
+
+// UserSearchResult — страница результатов SearchUsers
+type UserSearchResult struct {
+	Users []*User
+	Total int // -1, если CountTotal не задан
+}
+
+// userQuery накапливает условия WHERE и их параметры
+type userQuery struct {
+	where []string
+	args  []any
+}
+
+// add добавляет условие, заменяя ? на номер очередного параметра
+func (b *userQuery) add(cond string, arg any) {
+	b.args = append(b.args, arg)
+	b.where = append(b.where, strings.Replace(cond, "?", "$"+strconv.Itoa(len(b.args)), 1))
+}
+
+// next возвращает плейсхолдер для очередного параметра arg
+func (b *userQuery) next(arg any) string {
+	b.args = append(b.args, arg)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *userQuery) whereClause() string {
+	if len(b.where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.where, " AND ")
+}
+
+// buildUserFilter переводит фильтр в условия WHERE
+func buildUserFilter(f UserFilter) *userQuery {
+	b := &userQuery{}
+	if f.Role != "" {
+		b.add("role = ?", f.Role)
+	}
+	if f.Confirmed != nil {
+		b.add("confirmed = ?", *f.Confirmed)
+	}
+	if !f.CreatedFrom.IsZero() {
+		b.add("created_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		b.add("created_at < ?", f.CreatedTo)
+	}
+	if !f.LastLoginFrom.IsZero() {
+		b.add("last_login_at >= ?", f.LastLoginFrom)
+	}
+	if !f.LastLoginTo.IsZero() {
+		b.add("last_login_at < ?", f.LastLoginTo)
+	}
+	if f.UsernamePrefix != "" {
+		b.add(`lower(username) LIKE ? ESCAPE '\'`, escapeLike(f.UsernamePrefix)+"%")
+	}
+	if f.EmailDomain != "" {
+		b.add(`lower(email) LIKE ? ESCAPE '\'`, "%@"+escapeLike(strings.ToLower(f.EmailDomain)))
+	}
+	return b
+}
+
+// buildUserOrder возвращает ORDER BY для ключей сортировки с id в конце
+func buildUserOrder(sorts []UserSort) (string, error) {
+	if len(sorts) == 0 {
+		sorts = []UserSort{{Field: SortByCreatedAt, Desc: true}}
+	}
+
+	parts := make([]string, 0, len(sorts)+1)
+	for _, s := range sorts {
+		col, err := s.Field.column()
+		if err != nil {
+			return "", err
+		}
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		if s.Field == SortByLastLogin {
+			dir += " NULLS LAST"
+		}
+		parts = append(parts, col+" "+dir)
+	}
+	parts = append(parts, "id ASC")
+	return "ORDER BY " + strings.Join(parts, ", "), nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// SearchUsers возвращает страницу пользователей, подходящих под filter, и,
+// если запрошено, их общее число
+func (r *userRepo) SearchUsers(ctx context.Context, filter UserFilter) (_ *UserSearchResult, err error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	filter.UsernamePrefix = r.normalizer().Username(filter.UsernamePrefix)
+	b := buildUserFilter(filter)
+	if !DeletedUsersIncluded(ctx) {
+		b.where = append(b.where, "deleted_at IS NULL")
+	}
+	order, err := buildUserOrder(filter.Sort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	where := b.whereClause()
+	countArgs := append([]any(nil), b.args...)
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		` + where + `
+		` + order + `
+		LIMIT ` + b.next(limit) + ` OFFSET ` + b.next(filter.Offset)
+
+	ctx, q, err := r.ins.start(ctx, "SearchUsers", query, b.args...)
+	defer q.finish(&err)
+	if err != nil {
+		return nil, err
+	}
+
+	exec := readerFor(ctx, r.conns)
+	rows, err := exec.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", ClassifyError(err))
+	}
+	defer rows.Close()
+
+	result := &UserSearchResult{Total: -1}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", ClassifyError(err))
+		}
+		result.Users = append(result.Users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", ClassifyError(err))
+	}
+	q.rows = int64(len(result.Users))
+
+	// Неполная страница сама определяет общее число, если она не пустая или начинается с начала
+	n := len(result.Users)
+	switch {
+	case !filter.CountTotal:
+	case n < limit && (n > 0 || filter.Offset == 0):
+		result.Total = filter.Offset + n
+	default:
+		countQuery := "SELECT COUNT(*) FROM users " + where
+		if err = exec.QueryRowContext(ctx, countQuery, countArgs...).Scan(&result.Total); err != nil {
+			return nil, fmt.Errorf("failed to count users: %w", ClassifyError(err))
+		}
+	}
+
+	return result, nil
+}